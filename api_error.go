@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+)
+
+const requestIDContextKey contextKey = "request_id"
+
+// APIError is the body of every error response:
+//
+//	{"error": {"code": "not_found", "message": "Product not found", "request_id": "..."}}
+type APIError struct {
+	Status    int         `json:"-"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// newAPIError creates an APIError whose code is derived from status.
+func newAPIError(status int, message string) *APIError {
+	return &APIError{Status: status, Code: errorCode(status), Message: message}
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusUnprocessableEntity:
+		return "validation_failed"
+	case http.StatusTooManyRequests:
+		return "too_many_requests"
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// toAPIError maps err to the APIError sent to the client. Errors that are not
+// recognised become a 500 without leaking their message.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var validationErrs ValidationErrors
+	if errors.As(err, &validationErrs) {
+		e := newAPIError(http.StatusUnprocessableEntity, "Validation failed")
+		e.Details = validationErrs
+		return e
+	}
+
+	var stockErr *OutOfStockError
+	if errors.As(err, &stockErr) {
+		e := newAPIError(http.StatusConflict, "Some items are out of stock")
+		e.Details = stockErr.Items
+		return e
+	}
+
+	switch {
+	case errors.Is(err, errTransactionStatusChanged):
+		return newAPIError(http.StatusConflict, "Transaction was modified by another request, please retry")
+	case errors.Is(err, errRefundReviewed):
+		return newAPIError(http.StatusConflict, "Refund was already reviewed")
+	case errors.Is(err, errRefundExceedsTotal):
+		return newAPIError(http.StatusConflict, "Refund exceeds the remaining amount of the transaction")
+	case errors.Is(err, errRefundExceedsQuantity):
+		return newAPIError(http.StatusConflict, "Refund exceeds the remaining quantity of a transaction item")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return newAPIError(http.StatusNotFound, "Resource not found")
+	case isDuplicateKeyError(err):
+		return newAPIError(http.StatusConflict, "Resource already exists")
+	case isForeignKeyError(err):
+		return newAPIError(http.StatusConflict, "Resource refers to or is still used by another resource")
+	}
+	return newAPIError(http.StatusInternalServerError, "Internal server error")
+}
+
+// notFoundOr replaces gorm.ErrRecordNotFound with a 404 carrying message and
+// returns other errors unchanged.
+func notFoundOr(err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return newAPIError(http.StatusNotFound, message)
+	}
+	return err
+}
+
+// conflictOr returns err when it is set and a 409 carrying message otherwise.
+// It is used after existence checks that may fail themselves.
+func conflictOr(err error, message string) error {
+	if err != nil {
+		return err
+	}
+	return newAPIError(http.StatusConflict, message)
+}
+
+// errDuplicateKey is the unique constraint violation of the in-memory
+// repositories.
+var errDuplicateKey = errors.New("duplicate key")
+
+// errForeignKey is the foreign key constraint violation of the in-memory
+// repositories.
+var errForeignKey = errors.New("foreign key constraint failed")
+
+// isDuplicateKeyError reports whether err is a unique constraint violation.
+func isDuplicateKeyError(err error) bool {
+	if errors.Is(err, errDuplicateKey) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "duplicate key value") || // postgres
+		strings.Contains(msg, "UNIQUE constraint failed") // sqlite
+}
+
+// isForeignKeyError reports whether err is a foreign key constraint violation,
+// e.g. a product pointing to a missing category or a category that still
+// has products being deleted.
+func isForeignKeyError(err error) bool {
+	if errors.Is(err, errForeignKey) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1451 || mysqlErr.Number == 1452
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "violates foreign key constraint") || // postgres
+		strings.Contains(msg, "FOREIGN KEY constraint failed") // sqlite
+}
+
+// writeError writes err as a JSON error envelope. Internal errors are logged
+// together with the request id so they can be correlated with the response.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := *toAPIError(err)
+	apiErr.RequestID = requestIDFromContext(r.Context())
+	if apiErr.Status >= 500 {
+		log.Printf("request_id=%s %s %s: %v", apiErr.RequestID, r.Method, r.URL.Path, err)
+	}
+
+	writeJSON(w, apiErr.Status, map[string]interface{}{"error": apiErr})
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, newAPIError(http.StatusNotFound, "Route not found"))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, newAPIError(http.StatusMethodNotAllowed, "Method not allowed"))
+}
+
+// requestIDMiddleware propagates the X-Request-ID header, generating one when
+// the client did not send it.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id, _ = randomToken(12)
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/jinzhu/gorm"
+)
+
+// cartLine is a cart item together with the product it refers to.
+type cartLine struct {
+	CartItem
+	Product Product
+}
+
+func (l cartLine) inStock() bool {
+	return l.Quantity <= l.Product.Stock
+}
+
+// loadCart returns the cart of the user with the current products. Items
+// whose product no longer exists are skipped.
+func (s *Server) loadCart(userID uint) ([]cartLine, error) {
+	items, err := s.repo.Carts.List(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ProductID
+	}
+	products, err := s.repo.Products.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	lines := make([]cartLine, 0, len(items))
+	for _, item := range items {
+		product, ok := byID[item.ProductID]
+		if !ok {
+			continue
+		}
+		lines = append(lines, cartLine{CartItem: item, Product: product})
+	}
+	return lines, nil
+}
+
+// writeCart responds with the current cart of the user.
+func (s *Server) writeCart(w http.ResponseWriter, r *http.Request, user *User) {
+	lines, err := s.loadCart(user.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newCartResponse(lines))
+}
+
+func (s *Server) getCartHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	s.writeCart(w, r, user)
+}
+
+func (s *Server) addCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req addCartItemRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if _, err := s.repo.Products.FindByID(req.ProductID); err != nil {
+		writeError(w, r, notFoundOr(err, "Product not found"))
+		return
+	}
+
+	// Produk yang sudah ada di keranjang ditambah jumlahnya
+	item, err := s.repo.Carts.Find(user.ID, req.ProductID)
+	switch {
+	case err == nil:
+		item.Quantity += req.Quantity
+		err = s.repo.Carts.Update(item)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = s.repo.Carts.Create(&CartItem{UserID: user.ID, ProductID: req.ProductID, Quantity: req.Quantity})
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	s.writeCart(w, r, user)
+}
+
+func (s *Server) updateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "Invalid product ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req updateCartItemRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	item, err := s.repo.Carts.Find(user.ID, productID)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Cart item not found"))
+		return
+	}
+
+	item.Quantity = req.Quantity
+	if err := s.repo.Carts.Update(item); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	s.writeCart(w, r, user)
+}
+
+func (s *Server) removeCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "Invalid product ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	item, err := s.repo.Carts.Find(user.ID, productID)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Cart item not found"))
+		return
+	}
+
+	if err := s.repo.Carts.Delete(item); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	s.writeCart(w, r, user)
+}
+
+func (s *Server) clearCartHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	if err := s.repo.Carts.Clear(user.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	s.writeCart(w, r, user)
+}
+
+// checkoutCartHandler turns the whole cart into one transaction priced with
+// the current product prices, then empties the cart.
+func (s *Server) checkoutCartHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req checkoutRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	// Shipping address must belong to the buyer
+	address, err := s.repo.Addresses.FindForUser(user, req.AddressID)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Address not found"))
+		return
+	}
+
+	lines, err := s.loadCart(user.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(lines) == 0 {
+		writeError(w, r, newAPIError(http.StatusUnprocessableEntity, "Cart is empty"))
+		return
+	}
+
+	items := make([]LogProduct, len(lines))
+	var outOfStock []outOfStockItem
+	for i, line := range lines {
+		items[i] = LogProduct{ProductID: line.ProductID, Quantity: line.Quantity, Price: line.Product.Price}
+		if !line.inStock() {
+			outOfStock = append(outOfStock, outOfStockItem{
+				ProductID: line.ProductID,
+				Quantity:  line.Quantity,
+				Stock:     line.Product.Stock,
+			})
+		}
+	}
+	if len(outOfStock) > 0 {
+		writeError(w, r, &OutOfStockError{Items: outOfStock})
+		return
+	}
+
+	// Stok diperiksa lagi dan dikurangi secara atomik saat transaksi dibuat
+	transaction := newTransaction(user.ID, address.ID, items)
+	if err := s.repo.Transactions.Create(&transaction); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Transaksi sudah dibuat, jadi kegagalan mengosongkan keranjang hanya dicatat
+	if err := s.repo.Carts.Clear(user.ID); err != nil {
+		log.Printf("request_id=%s failed to clear cart of user %d: %v", requestIDFromContext(r.Context()), user.ID, err)
+	}
+
+	writeJSON(w, http.StatusCreated, newTransactionResponse(&transaction))
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles select the defaults of the configuration. APP_ENV picks one,
+// "dev" is used when it is not set.
+const (
+	ProfileDev  = "dev"
+	ProfileTest = "test"
+	ProfileProd = "prod"
+)
+
+const defaultConfigFile = "config.yaml"
+
+// Config is the typed configuration of the application. LoadConfig fills it
+// from, in increasing order of precedence:
+//
+//  1. the defaults of the profile (APP_ENV)
+//  2. the YAML file named by CONFIG_FILE (config.yaml when it exists)
+//  3. the .env file
+//  4. environment variables
+type Config struct {
+	Env         string            `yaml:"-"`
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	JWT         JWTConfig         `yaml:"jwt"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Log         LogConfig         `yaml:"log"`
+	Upload      UploadConfig      `yaml:"upload"`
+	Jobs        JobsConfig        `yaml:"jobs"`
+	Payment     PaymentConfig     `yaml:"payment"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+
+	Login         LoginConfig         `yaml:"login"`
+	Notifier      NotifierConfig      `yaml:"notifier"`
+	PasswordReset PasswordResetConfig `yaml:"password_reset"`
+	Verification  VerificationConfig  `yaml:"verification"`
+}
+
+type ServerConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+	// ShutdownTimeout is how long in-flight requests may take to finish
+	// after SIGINT/SIGTERM before the server is closed forcibly.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// Addr returns the address the HTTP server listens on.
+func (c ServerConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+type DatabaseConfig struct {
+	// Connection is the dialect: mysql, postgres or sqlite3.
+	Connection string `yaml:"connection"`
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	// Database is the database name, or the file path for SQLite.
+	Database string `yaml:"database"`
+	SSLMode  string `yaml:"sslmode"`
+
+	// MaxOpenConns of 0 picks 25, or 1 for SQLite which allows a single writer.
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	ConnectRetries  int           `yaml:"connect_retries"`
+}
+
+type SigningKey struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+}
+
+type JWTConfig struct {
+	SigningKeys []SigningKey `yaml:"signing_keys"`
+	// ActiveKeyID signs new tokens; the last signing key when empty.
+	ActiveKeyID string        `yaml:"active_key_id"`
+	Issuer      string        `yaml:"issuer"`
+	Audience    string        `yaml:"audience"`
+	AccessTTL   time.Duration `yaml:"access_ttl"`
+	RefreshTTL  time.Duration `yaml:"refresh_ttl"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is text or json.
+	Format string `yaml:"format"`
+}
+
+type UploadConfig struct {
+	Dir string `yaml:"dir"`
+	// MaxSize is the maximum size of an uploaded file in bytes.
+	MaxSize      int64    `yaml:"max_size"`
+	AllowedTypes []string `yaml:"allowed_types"`
+}
+
+// JobsConfig configures the background workers.
+type JobsConfig struct {
+	// CleanupInterval is how often expired tokens and codes are purged.
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+	// LoginAttemptRetention is how long failed logins stay in the audit table.
+	LoginAttemptRetention time.Duration `yaml:"login_attempt_retention"`
+}
+
+// IdempotencyConfig configures the Idempotency-Key support of POST and PUT
+// requests.
+type IdempotencyConfig struct {
+	// TTL is how long the response to a key is kept for replay.
+	TTL time.Duration `yaml:"ttl"`
+	// LockTimeout is how long a request may take before a retry with the
+	// same key may run it again.
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+}
+
+// LoginConfig configures the backoff and lockout of failed logins.
+type LoginConfig struct {
+	// MaxFailures is the number of failures per account before lockout.
+	MaxFailures int `yaml:"max_failures"`
+	// IPMaxFailures is the number of failures per IP before lockout.
+	IPMaxFailures int           `yaml:"ip_max_failures"`
+	Lockout       time.Duration `yaml:"lockout"`
+	// BackoffBase is the first backoff delay, doubled per failure.
+	BackoffBase time.Duration `yaml:"backoff_base"`
+}
+
+// NotifierConfig selects where e-mails and text messages go. They are sent
+// over SMTP and the SMS gateway when configured, otherwise appended to the
+// file when a path is set and logged otherwise. Only SMTP and the gateway
+// are allowed in prod.
+type NotifierConfig struct {
+	SMTP       SMTPConfig `yaml:"smtp"`
+	MailerFile string     `yaml:"mailer_file"`
+	// SMSURL is the endpoint of the SMS gateway; SMSToken is sent as bearer
+	// token.
+	SMSURL   string `yaml:"sms_url"`
+	SMSToken string `yaml:"sms_token"`
+	SMSFile  string `yaml:"sms_file"`
+}
+
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Username and Password are optional; PLAIN auth is used when set.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+type PasswordResetConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+	// URL is the page of the frontend that receives ?token=; the e-mail
+	// only contains the token when it is empty.
+	URL string `yaml:"url"`
+}
+
+type VerificationConfig struct {
+	// RequiredForTransactions blocks users whose email and phone are not
+	// verified from checking out.
+	RequiredForTransactions bool `yaml:"required_for_transactions"`
+}
+
+type PaymentConfig struct {
+	// Provider selects the payment gateway: midtrans, or fake for local
+	// development and tests.
+	Provider string `yaml:"provider"`
+	// WebhookSecret signs the webhooks of the fake provider.
+	WebhookSecret string         `yaml:"webhook_secret"`
+	Midtrans      MidtransConfig `yaml:"midtrans"`
+}
+
+type MidtransConfig struct {
+	// ServerKey authenticates API calls and signs notifications.
+	ServerKey string `yaml:"server_key"`
+	// Production uses the production API instead of the sandbox.
+	Production bool `yaml:"production"`
+}
+
+// defaultConfig returns the defaults of profile.
+func defaultConfig(profile string) Config {
+	cfg := Config{
+		Env: profile,
+		Server: ServerConfig{
+			Port:              8888,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   15 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Connection:      DialectMySQL,
+			Host:            "127.0.0.1",
+			SSLMode:         "disable",
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectRetries:  5,
+		},
+		JWT: JWTConfig{
+			Issuer:     defaultJWTIssuer,
+			Audience:   defaultJWTAudience,
+			AccessTTL:  defaultAccessTTL,
+			RefreshTTL: defaultRefreshTTL,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID", "Idempotency-Key"},
+			MaxAge:         10 * time.Minute,
+		},
+		Log: LogConfig{Level: "info", Format: "text"},
+		Upload: UploadConfig{
+			Dir:          "uploads",
+			MaxSize:      5 << 20,
+			AllowedTypes: []string{"image/jpeg", "image/png", "image/webp"},
+		},
+		Jobs: JobsConfig{
+			CleanupInterval:       time.Hour,
+			LoginAttemptRetention: 90 * 24 * time.Hour,
+		},
+		Payment:     PaymentConfig{Provider: PaymentProviderFake},
+		Idempotency: IdempotencyConfig{TTL: 24 * time.Hour, LockTimeout: time.Minute},
+		Login: LoginConfig{
+			MaxFailures:   5,
+			IPMaxFailures: 20,
+			Lockout:       15 * time.Minute,
+			BackoffBase:   time.Second,
+		},
+		Notifier:      NotifierConfig{SMTP: SMTPConfig{Port: 587}},
+		PasswordReset: PasswordResetConfig{TTL: defaultPasswordResetTTL},
+	}
+
+	switch profile {
+	case ProfileDev:
+		cfg.CORS.AllowedOrigins = []string{"*"}
+		cfg.Log.Level = "debug"
+		cfg.Payment.WebhookSecret = "dev-webhook-secret"
+	case ProfileTest:
+		// Test tidak membutuhkan database server
+		cfg.Database.Connection = DialectSQLite
+		cfg.Database.Database = "e-golang-test.db"
+		cfg.Database.ConnectRetries = 1
+		cfg.Log.Level = "warn"
+		cfg.Payment.WebhookSecret = "test-webhook-secret"
+	case ProfileProd:
+		cfg.Log.Format = "json"
+		cfg.Payment.Provider = PaymentProviderMidtrans
+	}
+	return cfg
+}
+
+// LoadConfig loads and validates the configuration.
+func LoadConfig() (*Config, error) {
+	// .env tidak menimpa environment variable yang sudah ada, jadi env tetap menang
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading .env: %w", err)
+	}
+
+	profile := os.Getenv("APP_ENV")
+	if profile == "" {
+		profile = ProfileDev
+	}
+	cfg := defaultConfig(profile)
+
+	path, required := os.LookupEnv("CONFIG_FILE")
+	if !required {
+		path = defaultConfigFile
+	}
+	if err := cfg.loadYAML(path, required); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// loadYAML overlays the YAML file at path. A missing file is only an error
+// when it was asked for explicitly.
+func (c *Config) loadYAML(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overlays the environment variables documented in the README.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []string
+	str := func(key string, dst *string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	integer := func(key string, dst *int) {
+		if v, ok := lookup(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a number", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	size := func(key string, dst *int64) {
+		if v, ok := lookup(key); ok && v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a number", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	duration := func(key string, dst *time.Duration) {
+		if v, ok := lookup(key); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a duration", key, v))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := lookup(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a boolean", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	list := func(key string, dst *[]string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = splitList(v)
+		}
+	}
+
+	str("SERVER_HOST", &c.Server.Host)
+	integer("PORT", &c.Server.Port)
+	duration("SERVER_READ_TIMEOUT", &c.Server.ReadTimeout)
+	duration("SERVER_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	duration("SERVER_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	duration("SERVER_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	integer("SERVER_MAX_HEADER_BYTES", &c.Server.MaxHeaderBytes)
+	duration("SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	str("DB_CONNECTION", &c.Database.Connection)
+	str("DB_HOST", &c.Database.Host)
+	integer("DB_PORT", &c.Database.Port)
+	str("DB_USERNAME", &c.Database.Username)
+	str("DB_PASSWORD", &c.Database.Password)
+	str("DB_DATABASE", &c.Database.Database)
+	str("DB_SSLMODE", &c.Database.SSLMode)
+	integer("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	integer("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	duration("DB_CONN_MAX_IDLE_TIME", &c.Database.ConnMaxIdleTime)
+	integer("DB_CONNECT_RETRIES", &c.Database.ConnectRetries)
+
+	if v, ok := lookup("JWT_SIGNING_KEYS"); ok && v != "" {
+		keys, err := parseSigningKeys(v)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		c.JWT.SigningKeys = keys
+	}
+	str("JWT_ACTIVE_KEY_ID", &c.JWT.ActiveKeyID)
+	str("JWT_ISSUER", &c.JWT.Issuer)
+	str("JWT_AUDIENCE", &c.JWT.Audience)
+	duration("JWT_ACCESS_TTL", &c.JWT.AccessTTL)
+	duration("JWT_REFRESH_TTL", &c.JWT.RefreshTTL)
+
+	list("CORS_ALLOWED_ORIGINS", &c.CORS.AllowedOrigins)
+	list("CORS_ALLOWED_METHODS", &c.CORS.AllowedMethods)
+	list("CORS_ALLOWED_HEADERS", &c.CORS.AllowedHeaders)
+	boolean("CORS_ALLOW_CREDENTIALS", &c.CORS.AllowCredentials)
+	duration("CORS_MAX_AGE", &c.CORS.MaxAge)
+
+	str("LOG_LEVEL", &c.Log.Level)
+	str("LOG_FORMAT", &c.Log.Format)
+
+	str("UPLOAD_DIR", &c.Upload.Dir)
+	size("UPLOAD_MAX_SIZE", &c.Upload.MaxSize)
+	list("UPLOAD_ALLOWED_TYPES", &c.Upload.AllowedTypes)
+
+	duration("JOBS_CLEANUP_INTERVAL", &c.Jobs.CleanupInterval)
+	duration("JOBS_LOGIN_ATTEMPT_RETENTION", &c.Jobs.LoginAttemptRetention)
+
+	str("PAYMENT_PROVIDER", &c.Payment.Provider)
+	str("PAYMENT_WEBHOOK_SECRET", &c.Payment.WebhookSecret)
+	str("MIDTRANS_SERVER_KEY", &c.Payment.Midtrans.ServerKey)
+	boolean("MIDTRANS_PRODUCTION", &c.Payment.Midtrans.Production)
+
+	duration("IDEMPOTENCY_TTL", &c.Idempotency.TTL)
+	duration("IDEMPOTENCY_LOCK_TIMEOUT", &c.Idempotency.LockTimeout)
+
+	integer("LOGIN_MAX_FAILURES", &c.Login.MaxFailures)
+	integer("LOGIN_IP_MAX_FAILURES", &c.Login.IPMaxFailures)
+	duration("LOGIN_LOCKOUT", &c.Login.Lockout)
+	duration("LOGIN_BACKOFF_BASE", &c.Login.BackoffBase)
+
+	str("SMTP_HOST", &c.Notifier.SMTP.Host)
+	integer("SMTP_PORT", &c.Notifier.SMTP.Port)
+	str("SMTP_USERNAME", &c.Notifier.SMTP.Username)
+	str("SMTP_PASSWORD", &c.Notifier.SMTP.Password)
+	str("SMTP_FROM", &c.Notifier.SMTP.From)
+	str("MAILER_FILE", &c.Notifier.MailerFile)
+	str("SMS_URL", &c.Notifier.SMSURL)
+	str("SMS_TOKEN", &c.Notifier.SMSToken)
+	str("SMS_FILE", &c.Notifier.SMSFile)
+
+	duration("PASSWORD_RESET_TTL", &c.PasswordReset.TTL)
+	str("PASSWORD_RESET_URL", &c.PasswordReset.URL)
+
+	boolean("REQUIRE_VERIFIED_FOR_TRANSACTIONS", &c.Verification.RequiredForTransactions)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
+
+// parseSigningKeys parses comma separated "kid:secret" pairs.
+func parseSigningKeys(v string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, pair := range splitList(v) {
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("JWT_SIGNING_KEYS: invalid entry %q, expected kid:secret", pair)
+		}
+		keys = append(keys, SigningKey{ID: kid, Secret: secret})
+	}
+	return keys, nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate checks the whole configuration and reports every problem at once.
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Env == ProfileDev || c.Env == ProfileTest || c.Env == ProfileProd,
+		"env must be one of dev, test, prod (got %q)", c.Env)
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.MaxHeaderBytes >= 4096, "server.max_header_bytes must be at least 4096")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	dialect, err := normalizeDialect(c.Database.Connection)
+	check(err == nil, "database.connection must be one of mysql, postgres, sqlite3 (got %q)", c.Database.Connection)
+	if err == nil {
+		c.Database.Connection = dialect
+	}
+	if dialect != DialectSQLite {
+		check(c.Database.Host != "", "database.host is required")
+		check(c.Database.Database != "", "database.database is required")
+		check(c.Database.Username != "", "database.username is required")
+		check(c.Env != ProfileProd || c.Database.Password != "", "database.password is required in prod")
+	}
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.ConnectRetries > 0, "database.connect_retries must be at least 1")
+
+	check(len(c.JWT.SigningKeys) > 0, "jwt.signing_keys is required (JWT_SIGNING_KEYS=kid:secret)")
+	seen := map[string]bool{}
+	for _, key := range c.JWT.SigningKeys {
+		check(key.ID != "" && key.Secret != "", "jwt.signing_keys entries need an id and a secret")
+		check(!seen[key.ID], "jwt.signing_keys has duplicate id %q", key.ID)
+		check(c.Env != ProfileProd || len(key.Secret) >= 32, "jwt signing key %q must be at least 32 bytes in prod", key.ID)
+		seen[key.ID] = true
+	}
+	check(c.JWT.ActiveKeyID == "" || seen[c.JWT.ActiveKeyID], "jwt.active_key_id %q is not a signing key", c.JWT.ActiveKeyID)
+	check(c.JWT.AccessTTL > 0, "jwt.access_ttl must be positive")
+	check(c.JWT.RefreshTTL > c.JWT.AccessTTL, "jwt.refresh_ttl must be longer than jwt.access_ttl")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin != "*" || !c.CORS.AllowCredentials, "cors.allowed_origins cannot be \"*\" when cors.allow_credentials is set")
+		check(origin != "*" || c.Env != ProfileProd, "cors.allowed_origins cannot be \"*\" in prod")
+	}
+
+	check(logLevels[c.Log.Level] > 0, "log.level must be one of debug, info, warn, error (got %q)", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json (got %q)", c.Log.Format)
+
+	check(c.Upload.Dir != "", "upload.dir is required")
+	check(c.Upload.MaxSize > 0, "upload.max_size must be positive")
+
+	check(c.Jobs.CleanupInterval > 0, "jobs.cleanup_interval must be positive")
+	check(c.Jobs.LoginAttemptRetention > 0, "jobs.login_attempt_retention must be positive")
+
+	switch c.Payment.Provider {
+	case PaymentProviderFake:
+		// Provider fake membolehkan siapa pun menandai pembayaran lunas
+		check(c.Env != ProfileProd, "payment.provider fake is not allowed in prod")
+		check(c.Payment.WebhookSecret != "", "payment.webhook_secret is required")
+	case PaymentProviderMidtrans:
+		check(c.Payment.Midtrans.ServerKey != "", "payment.midtrans.server_key is required")
+		check(c.Env != ProfileProd || c.Payment.Midtrans.Production, "payment.midtrans.production must be set in prod")
+	default:
+		check(false, "payment.provider must be one of fake, midtrans (got %q)", c.Payment.Provider)
+	}
+
+	check(c.Idempotency.TTL > 0, "idempotency.ttl must be positive")
+	// Request yang masih berjalan tidak boleh diambil alih oleh retry
+	check(c.Idempotency.LockTimeout >= c.Server.WriteTimeout, "idempotency.lock_timeout must be at least server.write_timeout")
+	check(c.Idempotency.LockTimeout < c.Idempotency.TTL, "idempotency.lock_timeout must be shorter than idempotency.ttl")
+
+	check(c.Login.MaxFailures > 0, "login.max_failures must be at least 1")
+	check(c.Login.IPMaxFailures >= c.Login.MaxFailures, "login.ip_max_failures must be at least login.max_failures")
+	check(c.Login.Lockout > 0, "login.lockout must be positive")
+	check(c.Login.BackoffBase > 0 && c.Login.BackoffBase < c.Login.Lockout, "login.backoff_base must be positive and shorter than login.lockout")
+
+	if c.Notifier.SMTP.Host != "" {
+		check(c.Notifier.SMTP.Port > 0 && c.Notifier.SMTP.Port < 65536, "notifier.smtp.port must be between 1 and 65535")
+		check(c.Notifier.SMTP.From != "", "notifier.smtp.from is required")
+	}
+	if c.Notifier.SMSURL != "" {
+		u, err := url.Parse(c.Notifier.SMSURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"notifier.sms_url must be an absolute http(s) URL (got %q)", c.Notifier.SMSURL)
+		check(err != nil || c.Env != ProfileProd || u.Scheme == "https", "notifier.sms_url must use https in prod")
+	}
+	// Mailer dan SMS sender log/file hanya untuk lokal, di prod kode verifikasi
+	// dan token reset password tidak boleh berakhir di log atau file
+	check(c.Env != ProfileProd || c.Notifier.SMTP.Host != "", "notifier.smtp.host is required in prod")
+	check(c.Env != ProfileProd || c.Notifier.SMSURL != "", "notifier.sms_url is required in prod")
+
+	check(c.PasswordReset.TTL > 0 && c.PasswordReset.TTL <= 24*time.Hour, "password_reset.ttl must be positive and at most 24h")
+	if c.PasswordReset.URL != "" {
+		u, err := url.Parse(c.PasswordReset.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.RawQuery == "",
+			"password_reset.url must be an absolute http(s) URL without query (got %q)", c.PasswordReset.URL)
+		check(err != nil || c.Env != ProfileProd || u.Scheme == "https", "password_reset.url must use https in prod")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
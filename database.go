@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// Supported values of DB_CONNECTION. They match the dialect names of GORM
+// and the directories in migrations/.
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
+
+// normalizeDialect maps DB_CONNECTION to a supported dialect. MySQL is the
+// default to stay compatible with existing .env files.
+func normalizeDialect(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "mysql":
+		return DialectMySQL, nil
+	case "postgres", "postgresql", "pgsql":
+		return DialectPostgres, nil
+	case "sqlite3", "sqlite":
+		return DialectSQLite, nil
+	}
+	return "", fmt.Errorf("unsupported DB_CONNECTION %q (use mysql, postgres or sqlite3)", name)
+}
+
+// buildDSN returns the data source name of cfg for dialect.
+func buildDSN(dialect string, cfg DatabaseConfig) string {
+	port := strconv.Itoa(cfg.Port)
+
+	switch dialect {
+	case DialectPostgres:
+		if cfg.Port == 0 {
+			port = "5432"
+		}
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.Username, cfg.Password),
+			Host:     cfg.Host + ":" + port,
+			Path:     "/" + cfg.Database,
+			RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+		}
+		return dsn.String()
+	case DialectSQLite:
+		// Foreign keys are off by default in SQLite
+		database := cfg.Database
+		if database == "" {
+			database = "e-golang.db"
+		}
+		return fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", database)
+	default:
+		if cfg.Port == 0 {
+			port = "3306"
+		}
+		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			cfg.Username, cfg.Password, cfg.Host, port, cfg.Database)
+	}
+}
+
+// connectDB opens the database once and configures its connection pool from
+// cfg. The returned handle is shared by every request; gorm.DB is safe for
+// concurrent use.
+func connectDB(cfg DatabaseConfig) (*gorm.DB, error) {
+	dialect, err := normalizeDialect(cfg.Connection)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialect, buildDSN(dialect, cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite hanya mengizinkan satu writer, koneksi tambahan hanya menghasilkan "database is locked"
+	maxOpen := cfg.MaxOpenConns
+	if maxOpen == 0 {
+		maxOpen = 25
+		if dialect == DialectSQLite {
+			maxOpen = 1
+		}
+	}
+	sqlDB := db.DB()
+	sqlDB.SetMaxOpenConns(maxOpen)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	// Database bisa saja belum siap saat aplikasi start (mis. di docker compose)
+	retries := cfg.ConnectRetries
+	for attempt := 1; ; attempt++ {
+		if err = sqlDB.Ping(); err == nil {
+			return db, nil
+		}
+		if attempt >= retries {
+			db.Close()
+			return nil, err
+		}
+		log.Printf("database not ready (attempt %d/%d): %v", attempt, retries, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// CloseDB closes the connection pool. It runs during shutdown, so a failure
+// is only logged.
+func CloseDB(db *gorm.DB) {
+	err := db.Close()
+	if err != nil {
+		log.Printf("Error closing database connection: %v", err)
+		return
+	}
+	log.Println("Successfully closed database connection")
+}
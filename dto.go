@@ -0,0 +1,441 @@
+package main
+
+import "time"
+
+// Request DTOs only carry the fields a client is allowed to set. Server
+// controlled fields (IDs, owners, roles, prices, statuses, timestamps) are
+// filled in by the handlers.
+
+type registerRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,email"`
+	Phone    string `json:"phone" validate:"required,phone"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type updateAccountRequest struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"required,email"`
+	Phone string `json:"phone" validate:"required,phone"`
+}
+
+type addressRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Street   string `json:"street" validate:"required,max=255"`
+	City     string `json:"city" validate:"required,max=100"`
+	Province string `json:"province" validate:"required,max=100"`
+	Zipcode  string `json:"zipcode" validate:"required,zipcode"`
+}
+
+type categoryRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+	IsAdmin     bool   `json:"is_admin"`
+}
+
+type productRequest struct {
+	CategoryID  uint   `json:"category_id" validate:"required"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=5000"`
+	Price       uint   `json:"price" validate:"required,positive"`
+	Image       string `json:"image" validate:"max=255"`
+	Stock       uint   `json:"stock"`
+}
+
+type createTransactionRequest struct {
+	AddressID uint                     `json:"address_id" validate:"required"`
+	Items     []transactionItemRequest `json:"items" validate:"required,max=100,dive"`
+}
+
+type transactionItemRequest struct {
+	ProductID uint `json:"product_id" validate:"required"`
+	Quantity  uint `json:"quantity" validate:"required,positive"`
+}
+
+type addCartItemRequest struct {
+	ProductID uint `json:"product_id" validate:"required"`
+	Quantity  uint `json:"quantity" validate:"required,positive"`
+}
+
+type updateCartItemRequest struct {
+	Quantity uint `json:"quantity" validate:"required,positive"`
+}
+
+type checkoutRequest struct {
+	AddressID uint `json:"address_id" validate:"required"`
+}
+
+// simulatePaymentRequest picks the webhook the fake provider sends.
+type simulatePaymentRequest struct {
+	Result string `json:"result" validate:"required,oneof=authorized succeeded failed"`
+}
+
+func (req addressRequest) applyTo(address *Address) {
+	address.Name = req.Name
+	address.Street = req.Street
+	address.City = req.City
+	address.Province = req.Province
+	address.Zipcode = req.Zipcode
+}
+
+func (req categoryRequest) applyTo(category *Category) {
+	category.Name = req.Name
+	category.Description = req.Description
+	category.IsAdmin = req.IsAdmin
+}
+
+func (req productRequest) applyTo(product *Product) {
+	product.CategoryID = req.CategoryID
+	product.Name = req.Name
+	product.Description = req.Description
+	product.Price = req.Price
+	product.Image = req.Image
+	product.Stock = req.Stock
+}
+
+// Response DTOs decouple the API from the table schemas.
+
+type userResponse struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Phone           string     `json:"phone"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type addressResponse struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Name      string    `json:"name"`
+	Street    string    `json:"street"`
+	City      string    `json:"city"`
+	Province  string    `json:"province"`
+	Zipcode   string    `json:"zipcode"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type categoryResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsAdmin     bool      `json:"is_admin"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type productResponse struct {
+	ID          uint      `json:"id"`
+	UserID      uint      `json:"user_id"`
+	CategoryID  uint      `json:"category_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Price       uint      `json:"price"`
+	Image       string    `json:"image"`
+	Stock       uint      `json:"stock"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type transactionResponse struct {
+	ID              uint                      `json:"id"`
+	UserID          uint                      `json:"user_id"`
+	TotalPrice      uint                      `json:"total_price"`
+	AddressID       uint                      `json:"address_id"`
+	Status          string                    `json:"status"`
+	TransactionTime time.Time                 `json:"transaction_time"`
+	Items           []transactionItemResponse `json:"items"`
+	// RefundedAmount sums the approved refunds; NetPrice is what the buyer
+	// paid after them.
+	RefundedAmount uint      `json:"refunded_amount"`
+	NetPrice       uint      `json:"net_price"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// transactionItemResponse is a line of a transaction. Price is the price of
+// the product at the time of purchase.
+type transactionItemResponse struct {
+	ID        uint `json:"id"`
+	ProductID uint `json:"product_id"`
+	Quantity  uint `json:"quantity"`
+	Price     uint `json:"price"`
+	Subtotal  uint `json:"subtotal"`
+}
+
+type statusHistoryResponse struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    uint      `json:"actor_id"`
+	ActorRole  string    `json:"actor_role"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type paymentResponse struct {
+	ID            uint      `json:"id"`
+	TransactionID uint      `json:"transaction_id"`
+	Provider      string    `json:"provider"`
+	ChargeID      string    `json:"charge_id"`
+	Amount        uint      `json:"amount"`
+	Status        string    `json:"status"`
+	PaymentURL    string    `json:"payment_url,omitempty"`
+	RefundID      string    `json:"refund_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type refundResponse struct {
+	ID               uint                 `json:"id"`
+	TransactionID    uint                 `json:"transaction_id"`
+	Amount           uint                 `json:"amount"`
+	Reason           string               `json:"reason"`
+	Status           string               `json:"status"`
+	Items            []refundItemResponse `json:"items"`
+	Restocked        bool                 `json:"restocked"`
+	ReviewerID       uint                 `json:"reviewer_id,omitempty"`
+	ReviewNote       string               `json:"review_note,omitempty"`
+	ReviewedAt       *time.Time           `json:"reviewed_at,omitempty"`
+	ProviderRefundID string               `json:"provider_refund_id,omitempty"`
+	CreatedAt        time.Time            `json:"created_at"`
+}
+
+// refundItemResponse is the refunded quantity of the transaction item ItemID.
+type refundItemResponse struct {
+	ItemID    uint `json:"item_id"`
+	ProductID uint `json:"product_id"`
+	Quantity  uint `json:"quantity"`
+	Price     uint `json:"price"`
+	Subtotal  uint `json:"subtotal"`
+}
+
+// cartItemResponse prices an item with the current product price.
+type cartItemResponse struct {
+	ProductID uint   `json:"product_id"`
+	Name      string `json:"name"`
+	Price     uint   `json:"price"`
+	Quantity  uint   `json:"quantity"`
+	Subtotal  uint   `json:"subtotal"`
+	Stock     uint   `json:"stock"`
+	InStock   bool   `json:"in_stock"`
+}
+
+type cartResponse struct {
+	Items         []cartItemResponse `json:"items"`
+	TotalQuantity uint               `json:"total_quantity"`
+	TotalPrice    uint               `json:"total_price"`
+	// CanCheckout is false when the cart is empty or an item is out of stock.
+	CanCheckout bool `json:"can_checkout"`
+}
+
+func newUserResponse(user *User) userResponse {
+	return userResponse{
+		ID:              user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		Phone:           user.Phone,
+		Role:            normalizeRole(user.Role),
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		PhoneVerifiedAt: user.PhoneVerifiedAt,
+		TOTPEnabled:     user.TOTPEnabled,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+}
+
+func newAddressResponse(address *Address) addressResponse {
+	return addressResponse{
+		ID:        address.ID,
+		UserID:    address.UserID,
+		Name:      address.Name,
+		Street:    address.Street,
+		City:      address.City,
+		Province:  address.Province,
+		Zipcode:   address.Zipcode,
+		CreatedAt: address.CreatedAt,
+		UpdatedAt: address.UpdatedAt,
+	}
+}
+
+func newCategoryResponse(category *Category) categoryResponse {
+	return categoryResponse{
+		ID:          category.ID,
+		Name:        category.Name,
+		Description: category.Description,
+		IsAdmin:     category.IsAdmin,
+		CreatedAt:   category.CreatedAt,
+		UpdatedAt:   category.UpdatedAt,
+	}
+}
+
+func newCategoryListResponse(categories []Category) []categoryResponse {
+	res := make([]categoryResponse, len(categories))
+	for i := range categories {
+		res[i] = newCategoryResponse(&categories[i])
+	}
+	return res
+}
+
+func newProductResponse(product *Product) productResponse {
+	return productResponse{
+		ID:          product.ID,
+		UserID:      product.UserID,
+		CategoryID:  product.CategoryID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Image:       product.Image,
+		Stock:       product.Stock,
+		CreatedAt:   product.CreatedAt,
+		UpdatedAt:   product.UpdatedAt,
+	}
+}
+
+func newProductListResponse(products []Product) []productResponse {
+	res := make([]productResponse, len(products))
+	for i := range products {
+		res[i] = newProductResponse(&products[i])
+	}
+	return res
+}
+
+func newTransactionResponse(transaction *Transaction) transactionResponse {
+	res := transactionResponse{
+		ID:              transaction.ID,
+		UserID:          transaction.UserID,
+		TotalPrice:      transaction.TotalPrice,
+		AddressID:       transaction.AddressID,
+		Status:          transaction.Status,
+		TransactionTime: transaction.TransactionTime,
+		Items:           make([]transactionItemResponse, len(transaction.Items)),
+		RefundedAmount:  transaction.RefundedAmount(),
+		NetPrice:        transaction.TotalPrice - transaction.RefundedAmount(),
+		CreatedAt:       transaction.CreatedAt,
+		UpdatedAt:       transaction.UpdatedAt,
+	}
+	for i, item := range transaction.Items {
+		res.Items[i] = transactionItemResponse{
+			ID:        item.ID,
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+			Subtotal:  item.Subtotal(),
+		}
+	}
+	return res
+}
+
+func newTransactionListResponse(transactions []Transaction) []transactionResponse {
+	res := make([]transactionResponse, len(transactions))
+	for i := range transactions {
+		res[i] = newTransactionResponse(&transactions[i])
+	}
+	return res
+}
+
+func newCartResponse(lines []cartLine) cartResponse {
+	res := cartResponse{
+		Items:       make([]cartItemResponse, len(lines)),
+		CanCheckout: len(lines) > 0,
+	}
+	for i, line := range lines {
+		res.Items[i] = cartItemResponse{
+			ProductID: line.ProductID,
+			Name:      line.Product.Name,
+			Price:     line.Product.Price,
+			Quantity:  line.Quantity,
+			Subtotal:  line.Product.Price * line.Quantity,
+			Stock:     line.Product.Stock,
+			InStock:   line.inStock(),
+		}
+		res.TotalQuantity += line.Quantity
+		res.TotalPrice += res.Items[i].Subtotal
+		if !line.inStock() {
+			res.CanCheckout = false
+		}
+	}
+	return res
+}
+
+func newStatusHistoryListResponse(history []TransactionStatusHistory) []statusHistoryResponse {
+	res := make([]statusHistoryResponse, len(history))
+	for i, entry := range history {
+		res[i] = statusHistoryResponse{
+			FromStatus: entry.FromStatus,
+			ToStatus:   entry.ToStatus,
+			ActorID:    entry.ActorID,
+			ActorRole:  entry.ActorRole,
+			Note:       entry.Note,
+			CreatedAt:  entry.CreatedAt,
+		}
+	}
+	return res
+}
+
+func newPaymentResponse(payment *Payment) paymentResponse {
+	return paymentResponse{
+		ID:            payment.ID,
+		TransactionID: payment.TransactionID,
+		Provider:      payment.Provider,
+		ChargeID:      payment.ChargeID,
+		Amount:        payment.Amount,
+		Status:        payment.Status,
+		PaymentURL:    payment.PaymentURL,
+		RefundID:      payment.RefundID,
+		CreatedAt:     payment.CreatedAt,
+		UpdatedAt:     payment.UpdatedAt,
+	}
+}
+
+func newPaymentListResponse(payments []Payment) []paymentResponse {
+	res := make([]paymentResponse, len(payments))
+	for i := range payments {
+		res[i] = newPaymentResponse(&payments[i])
+	}
+	return res
+}
+
+func newRefundResponse(refund *Refund) refundResponse {
+	res := refundResponse{
+		ID:               refund.ID,
+		TransactionID:    refund.TransactionID,
+		Amount:           refund.Amount,
+		Reason:           refund.Reason,
+		Status:           refund.Status,
+		Items:            make([]refundItemResponse, len(refund.Items)),
+		Restocked:        refund.Restocked,
+		ReviewerID:       refund.ReviewerID,
+		ReviewNote:       refund.ReviewNote,
+		ReviewedAt:       refund.ReviewedAt,
+		ProviderRefundID: refund.ProviderRefundID,
+		CreatedAt:        refund.CreatedAt,
+	}
+	for i, item := range refund.Items {
+		res.Items[i] = refundItemResponse{
+			ItemID:    item.LogProductID,
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+			Subtotal:  item.Subtotal(),
+		}
+	}
+	return res
+}
+
+func newRefundListResponse(refunds []Refund) []refundResponse {
+	res := make([]refundResponse, len(refunds))
+	for i := range refunds {
+		res[i] = newRefundResponse(&refunds[i])
+	}
+	return res
+}
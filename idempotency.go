@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A client retrying a POST or PUT sends the same Idempotency-Key header as
+// the first attempt. The first request is handled normally and its response
+// stored per user and key for Idempotency.TTL; retries get that response
+// back with an Idempotent-Replayed header instead of running the handler
+// again. Server errors are not stored, so the request can be retried.
+//
+// A key is locked for Idempotency.LockTimeout while its request is handled.
+// The key is released when the handler panics or its response cannot be
+// stored; when the process dies the lock expires and a retry reclaims it.
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyReserveRetries = 2
+)
+
+// idempotencyMiddleware applies Idempotency-Key to the POST and PUT requests
+// of authenticated users. It must run after authMiddleware.
+func (s *Server) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, newAPIError(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters"))
+			return
+		}
+		user, ok := userFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Body dibaca dulu untuk hash, lalu dikembalikan untuk handler
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record, stored, err := s.reserveIdempotencyKey(user.ID, key, requestHash(r, body))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if stored != nil {
+			replayResponse(w, stored)
+			return
+		}
+
+		completed := false
+		defer func() {
+			// Handler panic: key dilepas agar retry tidak tertahan 409
+			if !completed {
+				s.releaseIdempotencyKey(r, record)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		completed = true
+		if err := s.completeIdempotencyKey(record, rec); err != nil {
+			log.Printf("request_id=%s failed to store response for idempotency key: %v", requestIDFromContext(r.Context()), err)
+			s.releaseIdempotencyKey(r, record)
+		}
+	})
+}
+
+// requestHash identifies a request by its method, path and body, so a key
+// reused for a different request can be told apart from a retry.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reserveIdempotencyKey records that the request with key is being handled.
+// When the key was used before it returns the stored response instead, a 422
+// when the earlier request differs or a 409 when it has not finished yet.
+func (s *Server) reserveIdempotencyKey(userID uint, key, hash string) (*IdempotencyKey, *IdempotencyKey, error) {
+	now := time.Now()
+	for i := 0; i < idempotencyReserveRetries; i++ {
+		existing, err := s.repo.IdempotencyKeys.Find(userID, key)
+		switch {
+		case err == nil && existing.ExpiresAt.Before(now):
+			if err := s.repo.IdempotencyKeys.Delete(existing); err != nil {
+				return nil, nil, err
+			}
+		case err == nil && existing.RequestHash != hash:
+			return nil, nil, newAPIError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+		case err == nil && existing.StatusCode == 0:
+			// Request pertama dianggap mati setelah lock-nya habis
+			reclaimed, err := s.repo.IdempotencyKeys.Reclaim(existing, now)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !reclaimed {
+				return nil, nil, newAPIError(http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+			}
+		case err == nil:
+			return nil, existing, nil
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, nil, err
+		}
+
+		lockedUntil := now.Add(s.config.Idempotency.LockTimeout)
+		record := IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hash,
+			LockedUntil: &lockedUntil,
+			ExpiresAt:   now.Add(s.config.Idempotency.TTL),
+		}
+		// Unique index (user_id, idempotency_key) memastikan hanya satu dari
+		// request yang bersamaan yang menang; sisanya membaca ulang key-nya
+		err = s.repo.IdempotencyKeys.Create(&record)
+		if err == nil {
+			return &record, nil, nil
+		}
+		if !isDuplicateKeyError(err) {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, newAPIError(http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+}
+
+// completeIdempotencyKey stores the response recorded for record. A server
+// error releases the key instead, so the client can retry.
+func (s *Server) completeIdempotencyKey(record *IdempotencyKey, rec *responseRecorder) error {
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= 500 {
+		return s.repo.IdempotencyKeys.Delete(record)
+	}
+	record.StatusCode = status
+	record.ContentType = rec.Header().Get("Content-Type")
+	record.ResponseBody = rec.body.String()
+	return s.repo.IdempotencyKeys.Complete(record)
+}
+
+// releaseIdempotencyKey deletes the reservation of a request whose response
+// is not stored, so a retry does not get a 409 until the lock expires.
+func (s *Server) releaseIdempotencyKey(r *http.Request, record *IdempotencyKey) {
+	if err := s.repo.IdempotencyKeys.Delete(record); err != nil {
+		log.Printf("request_id=%s failed to release idempotency key: %v", requestIDFromContext(r.Context()), err)
+	}
+}
+
+// replayResponse writes the stored response of an earlier request.
+func replayResponse(w http.ResponseWriter, stored *IdempotencyKey) {
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(stored.StatusCode)
+	io.WriteString(w, stored.ResponseBody)
+}
+
+// responseRecorder passes the response through while keeping a copy of the
+// status code and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
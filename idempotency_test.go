@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// idempotentOrder posts req with the given Idempotency-Key, decodes the
+// response body into out unless it is nil and returns the response.
+func (ts *testServer) idempotentOrder(token, key string, req createTransactionRequest, out interface{}) *http.Response {
+	ts.t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	r, err := http.NewRequest("POST", ts.http.URL+"/api/transactions", bytes.NewReader(body))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set(idempotencyKeyHeader, key)
+	resp, err := ts.http.Client().Do(r)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			ts.t.Fatalf("decode response: %v", err)
+		}
+	}
+	return resp
+}
+
+// idempotencyFixture returns a buyer, their token and an order request of
+// one item of a product with 5 in stock.
+func (ts *testServer) idempotencyFixture() (*User, string, createTransactionRequest) {
+	ts.t.Helper()
+	_, adminToken := ts.user("Admin", RoleAdmin)
+	_, sellerToken := ts.user("Seller", RoleSeller)
+	buyer, buyerToken := ts.user("Buyer", RoleBuyer)
+	product := ts.product(sellerToken, ts.category(adminToken), 5)
+	return buyer, buyerToken, createTransactionRequest{
+		AddressID: ts.address(buyerToken).ID,
+		Items:     []transactionItemRequest{{ProductID: product.ID, Quantity: 1}},
+	}
+}
+
+// reserveKey stores a key whose request is still being handled until
+// lockedUntil, as if another request had reserved it.
+func (ts *testServer) reserveKey(user *User, key string, req createTransactionRequest, lockedUntil time.Time) {
+	ts.t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	record := IdempotencyKey{
+		UserID:      user.ID,
+		Key:         key,
+		RequestHash: requestHash(httptest.NewRequest("POST", "/api/transactions", nil), body),
+		LockedUntil: &lockedUntil,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	if err := ts.srv.repo.IdempotencyKeys.Create(&record); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, token, req := ts.idempotencyFixture()
+		productID := req.Items[0].ProductID
+
+		var first, second transactionResponse
+		if resp := ts.idempotentOrder(token, "order-1", req, &first); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("first request: status %d", resp.StatusCode)
+		}
+		resp := ts.idempotentOrder(token, "order-1", req, &second)
+		if resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotentReplayedHeader) != "true" {
+			t.Errorf("retry: status %d, replayed %q", resp.StatusCode, resp.Header.Get(idempotentReplayedHeader))
+		}
+		if second.ID != first.ID {
+			t.Errorf("retry returned transaction %d, want %d", second.ID, first.ID)
+		}
+		if got := ts.stock(token, productID); got != 4 {
+			t.Errorf("stock = %d, want 4 after one order", got)
+		}
+
+		// Key lain membuat order baru
+		if resp := ts.idempotentOrder(token, "order-2", req, nil); resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotentReplayedHeader) != "" {
+			t.Errorf("new key: status %d, replayed %q", resp.StatusCode, resp.Header.Get(idempotentReplayedHeader))
+		}
+		if got := ts.stock(token, productID); got != 3 {
+			t.Errorf("stock = %d, want 3 after two orders", got)
+		}
+	})
+}
+
+func TestIdempotencyKeyReusedForDifferentRequest(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, token, req := ts.idempotencyFixture()
+		if resp := ts.idempotentOrder(token, "order-1", req, nil); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("first request: status %d", resp.StatusCode)
+		}
+
+		req.Items[0].Quantity = 2
+		if resp := ts.idempotentOrder(token, "order-1", req, nil); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("different body: status %d, want 422", resp.StatusCode)
+		}
+		if got := ts.stock(token, req.Items[0].ProductID); got != 4 {
+			t.Errorf("stock = %d, want 4", got)
+		}
+	})
+}
+
+func TestIdempotencyKeyInFlight(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		buyer, token, req := ts.idempotencyFixture()
+		ts.reserveKey(buyer, "order-1", req, time.Now().Add(time.Minute))
+
+		if resp := ts.idempotentOrder(token, "order-1", req, nil); resp.StatusCode != http.StatusConflict {
+			t.Errorf("request while the first is running: status %d, want 409", resp.StatusCode)
+		}
+		if got := ts.stock(token, req.Items[0].ProductID); got != 5 {
+			t.Errorf("stock = %d, want 5", got)
+		}
+	})
+}
+
+func TestIdempotencyKeyExpiredLockIsReclaimed(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		buyer, token, req := ts.idempotencyFixture()
+		// Request pertama mati tanpa melepas key-nya
+		ts.reserveKey(buyer, "order-1", req, time.Now().Add(-time.Second))
+
+		var created transactionResponse
+		if resp := ts.idempotentOrder(token, "order-1", req, &created); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("retry after the lock expired: status %d, want 201", resp.StatusCode)
+		}
+		var replayed transactionResponse
+		resp := ts.idempotentOrder(token, "order-1", req, &replayed)
+		if resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotentReplayedHeader) != "true" || replayed.ID != created.ID {
+			t.Errorf("retry after reclaim: status %d, replayed %q, transaction %d, want %d",
+				resp.StatusCode, resp.Header.Get(idempotentReplayedHeader), replayed.ID, created.ID)
+		}
+		if got := ts.stock(token, req.Items[0].ProductID); got != 4 {
+			t.Errorf("stock = %d, want 4", got)
+		}
+	})
+}
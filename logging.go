@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// logLevels orders the values of log.level; 0 means unknown.
+var logLevels = map[string]int{
+	"debug": 1,
+	"info":  2,
+	"warn":  3,
+	"error": 4,
+}
+
+// setupLogging configures the standard logger. With the json format every
+// line written through the log package becomes a JSON object.
+func setupLogging(cfg LogConfig) {
+	if cfg.Format == "json" {
+		log.SetFlags(0)
+		log.SetOutput(jsonLogWriter{out: os.Stderr})
+		return
+	}
+	log.SetFlags(log.LstdFlags)
+	log.SetOutput(os.Stderr)
+}
+
+// jsonLogWriter wraps plain log lines in {"time", "level", "msg"}. Lines that
+// already are JSON objects (access logs) are written unchanged.
+type jsonLogWriter struct {
+	out io.Writer
+}
+
+func (w jsonLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+	if !strings.HasPrefix(line, "{") {
+		b, err := json.Marshal(map[string]string{
+			"time":  time.Now().UTC().Format(time.RFC3339Nano),
+			"level": "info",
+			"msg":   line,
+		})
+		if err != nil {
+			return 0, err
+		}
+		line = string(b)
+	}
+	if _, err := io.WriteString(w.out, line+"\n"); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// accessLogMiddleware logs one line per request. Successful requests are
+// logged at info, 4xx at warn and 5xx at error, and only lines at or above
+// cfg.Level are written.
+func accessLogMiddleware(cfg LogConfig) func(http.Handler) http.Handler {
+	minLevel := logLevels[cfg.Level]
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			level := "info"
+			switch {
+			case rec.status >= 500:
+				level = "error"
+			case rec.status >= 400:
+				level = "warn"
+			}
+			if logLevels[level] < minLevel {
+				return
+			}
+
+			duration := time.Since(start)
+			requestID := w.Header().Get("X-Request-ID")
+			if cfg.Format == "json" {
+				b, _ := json.Marshal(map[string]interface{}{
+					"time":        start.UTC().Format(time.RFC3339Nano),
+					"level":       level,
+					"msg":         "request",
+					"method":      r.Method,
+					"path":        r.URL.Path,
+					"status":      rec.status,
+					"bytes":       rec.bytes,
+					"duration_ms": duration.Milliseconds(),
+					"remote_ip":   clientIP(r),
+					"request_id":  requestID,
+				})
+				log.Print(string(b))
+				return
+			}
+			log.Printf("%s %s %s %d %dB %s request_id=%s",
+				strings.ToUpper(level), r.Method, r.URL.Path, rec.status, rec.bytes, duration, requestID)
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// LoginAttemptState is the failed-login counter kept for one key (an account
+// or a client IP).
+type LoginAttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore persists LoginAttemptState per key. Update must apply fn
+// atomically so concurrent logins cannot lose failures.
+type AttemptStore interface {
+	Get(key string) (LoginAttemptState, error)
+	Update(key string, fn func(*LoginAttemptState)) (LoginAttemptState, error)
+	Delete(key string) error
+}
+
+// memoryAttemptStore is the default AttemptStore. Counters are lost on
+// restart and are not shared between instances.
+type memoryAttemptStore struct {
+	mu     sync.Mutex
+	states map[string]LoginAttemptState
+}
+
+func newMemoryAttemptStore() *memoryAttemptStore {
+	return &memoryAttemptStore{states: map[string]LoginAttemptState{}}
+}
+
+func (s *memoryAttemptStore) Get(key string) (LoginAttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+func (s *memoryAttemptStore) Update(key string, fn func(*LoginAttemptState)) (LoginAttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[key]
+	fn(&state)
+	s.states[key] = state
+	return state, nil
+}
+
+func (s *memoryAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+// LoginLimiter slows down and locks out repeated failed logins for a key.
+// After freeFailures failures every further attempt has to wait an
+// exponentially growing delay, and after maxFailures the key is locked for
+// lockoutDuration.
+type LoginLimiter struct {
+	store           AttemptStore
+	prefix          string
+	freeFailures    int
+	maxFailures     int
+	baseDelay       time.Duration
+	lockoutDuration time.Duration
+	// resetAfter forgets failures older than this.
+	resetAfter time.Duration
+	now        func() time.Time
+}
+
+// newLoginLimiters creates the per-account and per-IP limiters from cfg.
+func newLoginLimiters(cfg LoginConfig, store AttemptStore) (account, ip *LoginLimiter) {
+	account = &LoginLimiter{
+		store:           store,
+		prefix:          "account:",
+		freeFailures:    2,
+		maxFailures:     cfg.MaxFailures,
+		baseDelay:       cfg.BackoffBase,
+		lockoutDuration: cfg.Lockout,
+		resetAfter:      24 * time.Hour,
+		now:             time.Now,
+	}
+	ip = &LoginLimiter{
+		store:           store,
+		prefix:          "ip:",
+		freeFailures:    5,
+		maxFailures:     cfg.IPMaxFailures,
+		baseDelay:       cfg.BackoffBase,
+		lockoutDuration: cfg.Lockout,
+		resetAfter:      24 * time.Hour,
+		now:             time.Now,
+	}
+	return account, ip
+}
+
+// RetryAfter returns how long the key has to wait before the next attempt,
+// or zero when an attempt is allowed now.
+func (l *LoginLimiter) RetryAfter(key string) (time.Duration, error) {
+	state, err := l.store.Get(l.prefix + key)
+	if err != nil {
+		return 0, err
+	}
+	now := l.now()
+	if now.Sub(state.LastFailure) > l.resetAfter {
+		return 0, nil
+	}
+
+	next := state.LockedUntil
+	if backoff := state.LastFailure.Add(l.backoff(state.Failures)); backoff.After(next) {
+		next = backoff
+	}
+	if next.After(now) {
+		return next.Sub(now), nil
+	}
+	return 0, nil
+}
+
+func (l *LoginLimiter) backoff(failures int) time.Duration {
+	n := failures - l.freeFailures
+	if n <= 0 {
+		return 0
+	}
+	delay := time.Duration(float64(l.baseDelay) * math.Pow(2, float64(n-1)))
+	if delay > l.lockoutDuration || delay <= 0 {
+		return l.lockoutDuration
+	}
+	return delay
+}
+
+// Fail records a failed attempt and reports whether the key is now locked.
+func (l *LoginLimiter) Fail(key string) (bool, error) {
+	now := l.now()
+	state, err := l.store.Update(l.prefix+key, func(s *LoginAttemptState) {
+		if now.Sub(s.LastFailure) > l.resetAfter {
+			*s = LoginAttemptState{}
+		}
+		s.Failures++
+		s.LastFailure = now
+		if s.Failures >= l.maxFailures {
+			s.LockedUntil = now.Add(l.lockoutDuration)
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	return state.Failures >= l.maxFailures, nil
+}
+
+// Reset clears the failures of the key, e.g. after a successful login or
+// when an admin unlocks an account.
+func (l *LoginLimiter) Reset(key string) error {
+	return l.store.Delete(l.prefix + key)
+}
+
+// clientIP returns the IP address of the client that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkLoginAllowed writes a 429 with Retry-After and returns false when the
+// account or the IP has to wait.
+func (s *Server) checkLoginAllowed(w http.ResponseWriter, r *http.Request, email string) bool {
+	ip := clientIP(r)
+	wait, err := s.accountLimiter.RetryAfter(strings.ToLower(email))
+	if err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	ipWait, err := s.ipLimiter.RetryAfter(ip)
+	if err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeError(w, r, newAPIError(http.StatusTooManyRequests, fmt.Sprintf("Too many failed login attempts, try again in %d seconds", seconds)))
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed attempt for the account and the IP and
+// writes it to the login_attempts audit table.
+func (s *Server) recordLoginFailure(r *http.Request, email, reason string) {
+	ip := clientIP(r)
+	locked, err := s.accountLimiter.Fail(strings.ToLower(email))
+	if err != nil {
+		log.Printf("failed to record login failure: %v", err)
+	}
+	if _, err := s.ipLimiter.Fail(ip); err != nil {
+		log.Printf("failed to record login failure: %v", err)
+	}
+	if locked {
+		log.Printf("account %s locked after too many failed login attempts", email)
+	}
+
+	attempt := LoginAttempt{
+		Email:     email,
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		Reason:    reason,
+	}
+	if err := s.repo.LoginAttempts.Create(&attempt); err != nil {
+		log.Printf("failed to audit login failure: %v", err)
+	}
+}
+
+// recordLoginSuccess clears the account counter. The IP counter is left as is,
+// otherwise an attacker could reset it by logging into their own account.
+func (s *Server) recordLoginSuccess(email string) {
+	if err := s.accountLimiter.Reset(strings.ToLower(email)); err != nil {
+		log.Printf("failed to reset login failures: %v", err)
+	}
+}
+
+// unlockUserHandler lets an admin lift the lockout of an account.
+func (s *Server) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, "invalid user ID"))
+		return
+	}
+
+	user, err := s.repo.Users.FindByID(uint(userID))
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "User not found"))
+		return
+	}
+
+	if err := s.accountLimiter.Reset(strings.ToLower(user.Email)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Account unlocked"})
+}
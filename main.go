@@ -1,102 +1,99 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql"
-	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var DB *gorm.DB
-
-func connectDB() (*gorm.DB, error) {
-	err := godotenv.Load()
-	dbConn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local",
-		os.Getenv("DB_USERNAME"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_DATABASE"),
-	)
-	db, err := gorm.Open(os.Getenv("DB_CONNECTION"), dbConn)
-	if err != nil {
-		log.Fatal("Error loading .env file")
+func main() {
+	// Subcommand untuk menjalankan migrasi database
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	return db, nil
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func CloseDB(db *gorm.DB) {
-	err := db.Close()
+// run starts the API and blocks until SIGINT/SIGTERM, then drains in-flight
+// requests, stops the background workers and closes the database. Returning
+// instead of calling log.Fatal lets the deferred cleanup run.
+func run() error {
+	// Membaca dan memvalidasi konfigurasi
+	cfg, err := LoadConfig()
 	if err != nil {
-		log.Fatal("Error closing database connection")
+		return err
 	}
-	fmt.Println("Successfully closed database connection")
-}
+	setupLogging(cfg.Log)
+	log.Printf("Starting with profile %q", cfg.Env)
 
-func main() {
 	// Membuat koneksi ke database
-	db, err := connectDB()
-
+	db, err := connectDB(cfg.Database)
 	if err != nil {
-		fmt.Println("Failed to connect to database:", err)
-	} else {
-		fmt.Println("Successfully connected to database")
+		return fmt.Errorf("failed to connect to database: %w", err)
 	}
+	log.Println("Successfully connected to database")
+	defer CloseDB(db)
 
-	defer db.Close()
-
-	r := mux.NewRouter()
-
-	// Login and register routes
-	r.HandleFunc("/api/auth/register", registerHandler).Methods("POST")
-	r.HandleFunc("/api/auth/login", loginHandler).Methods("POST")
-
-	// Account routes
-	r.HandleFunc("/api/accounts/me", getAccountHandler).Methods("GET")
-	r.HandleFunc("/api/accounts/me", updateAccountHandler).Methods("PUT")
-
-	// Address routes
-	r.HandleFunc("/api/addresses", createAddressHandler).Methods("POST")
-	r.HandleFunc("/api/addresses/{id}", getAddressHandler).Methods("GET")
-	r.HandleFunc("/api/addresses/{id}", updateAddressHandler).Methods("PUT")
-	r.HandleFunc("/api/addresses/{id}", deleteAddressHandler).Methods("DELETE")
+	// Menyiapkan token service dari konfigurasi
+	tokens, err := newTokenServiceFromConfig(cfg.JWT)
+	if err != nil {
+		return fmt.Errorf("failed to load JWT configuration: %w", err)
+	}
 
-	// Category routes
-	r.HandleFunc("/api/categories", createCategoryHandler).Methods("POST")
-	r.HandleFunc("/api/categories", getCategoryListHandler).Methods("GET")
-	r.HandleFunc("/api/categories/{id}", getCategoryHandler).Methods("GET")
-	r.HandleFunc("/api/categories/{id}", updateCategoryHandler).Methods("PUT")
-	r.HandleFunc("/api/categories/{id}", deleteCategoryHandler).Methods("DELETE")
+	srv := NewServer(cfg, db, tokens)
 
-	// Product routes
-	r.HandleFunc("/api/products", createProductHandler).Methods("POST")
-	r.HandleFunc("/api/products", getProductListHandler).Methods("GET")
-	r.HandleFunc("/api/products/{id}", getProductHandler).Methods("GET")
-	r.HandleFunc("/api/products/{id}", updateProductHandler).Methods("PUT")
-	r.HandleFunc("/api/products/{id}", deleteProductHandler).Methods("DELETE")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Transaction routes
-	r.HandleFunc("/api/transactions", createTransactionHandler).Methods("POST")
-	r.HandleFunc("/api/transactions", getTransactionListHandler).Methods("GET")
-	r.HandleFunc("/api/transactions/{id}", getTransactionHandler).Methods("GET")
-	r.HandleFunc("/api/transactions/{id}/confirm", confirmTransactionHandler).Methods("POST")
+	// Worker berhenti saat ctx dibatalkan oleh signal
+	workers := srv.startWorkers(ctx)
 
 	// Serve the API
-	log.Fatal(http.ListenAndServe(":8888", r))
+	httpServer := srv.httpServer()
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", httpServer.Addr)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		// Server gagal start (mis. port sudah dipakai)
+		stop()
+		workers.Wait()
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", cfg.Server.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+		httpServer.Close()
+	}
+	workers.Wait()
+	srv.background.Wait()
+	log.Println("Server stopped")
+	return nil
 }
 
 type User struct {
@@ -107,9 +104,19 @@ type User struct {
 	Phone     string    `json:"phone" gorm:"unique"`
 	Address   []Address `json:"address,omitempty" gorm:"foreignkey:UserID"`
 	Store     Store     `json:"store,omitempty" gorm:"foreignkey:UserID"`
-	Role      string    `json:"role" gorm:"default:'user'"`
+	Role      string    `json:"role" gorm:"default:'buyer'"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+
+	// TokensValidAfter menolak access token yang diterbitkan sampai saat ini,
+	// dengan presisi mikrodetik (diisi saat user logout dari semua perangkat).
+	TokensValidAfter *time.Time `json:"-"`
 }
 
 type Address struct {
@@ -156,16 +163,16 @@ type Product struct {
 }
 
 type Transaction struct {
-	ID              uint      `gorm:"primary_key" json:"id"`
-	UserID          uint      `json:"user_id"`
-	ProductID       uint      `json:"product_id"`
-	Quantity        uint      `json:"quantity"`
-	TotalPrice      uint      `json:"total_price"`
-	AddressID       uint      `json:"address_id"`
-	Status          string    `json:"status"`
-	TransactionTime time.Time `json:"transaction_time"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              uint         `gorm:"primary_key" json:"id"`
+	UserID          uint         `json:"user_id"`
+	TotalPrice      uint         `json:"total_price"`
+	AddressID       uint         `json:"address_id"`
+	Status          string       `json:"status"`
+	TransactionTime time.Time    `json:"transaction_time"`
+	Items           []LogProduct `json:"items" gorm:"foreignkey:TransactionID"`
+	Refunds         []Refund     `json:"refunds" gorm:"foreignkey:TransactionID"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
 }
 
 type LogProduct struct {
@@ -178,280 +185,404 @@ type LogProduct struct {
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
-func isEmailExist(email string) bool {
-	db, err := connectDB()
-	defer db.Close()
+// TransactionStatusHistory records one status change of a transaction.
+type TransactionStatusHistory struct {
+	ID            uint   `gorm:"primary_key" json:"id"`
+	TransactionID uint   `json:"transaction_id"`
+	FromStatus    string `json:"from_status"`
+	ToStatus      string `json:"to_status"`
+	// ActorID is the user who changed the status, 0 for the system.
+	ActorID   uint      `json:"actor_id"`
+	ActorRole string    `json:"actor_role"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
 
-	var count int
-	err = db.Raw("SELECT count(*) FROM users WHERE email=?", email).Scan(&count).Error
-	if err != nil {
-		log.Fatal(err)
-	}
-	return count > 0
+// Payment is a charge created at the payment provider for a transaction.
+type Payment struct {
+	ID            uint      `gorm:"primary_key" json:"id"`
+	TransactionID uint      `json:"transaction_id"`
+	Provider      string    `json:"provider"`
+	ChargeID      string    `json:"charge_id"`
+	Amount        uint      `json:"amount"`
+	Status        string    `json:"status"`
+	PaymentURL    string    `json:"payment_url"`
+	RefundID      string    `json:"refund_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
-func isPhoneExist(phone string) bool {
-	db, err := connectDB()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+// PaymentEvent is a webhook event that has been processed, kept so a
+// redelivered event is applied only once.
+type PaymentEvent struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	Provider  string    `json:"provider"`
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	ChargeID  string    `json:"charge_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
 
-	var count int
-	row := db.Raw("SELECT count(*) FROM users WHERE phone=?", phone).Row()
-	row.Scan(&count)
+// Refund returns part or all of a transaction to the buyer. Approved refunds
+// form the refund ledger of the transaction.
+type Refund struct {
+	ID            uint         `gorm:"primary_key" json:"id"`
+	TransactionID uint         `json:"transaction_id"`
+	UserID        uint         `json:"user_id"`
+	Amount        uint         `json:"amount"`
+	Reason        string       `json:"reason"`
+	Status        string       `json:"status"`
+	Items         []RefundItem `json:"items" gorm:"foreignkey:RefundID"`
+	// Restocked is set when the quantities were put back into the stock.
+	Restocked bool `json:"restocked"`
+	// ReviewerID is the seller or admin who approved or rejected the refund.
+	ReviewerID       uint       `json:"reviewer_id"`
+	ReviewNote       string     `json:"review_note"`
+	ReviewedAt       *time.Time `json:"reviewed_at"`
+	ProviderRefundID string     `json:"provider_refund_id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
 
-	return count > 0
+// RefundItem is the quantity of a transaction line that is refunded, priced
+// with the price of the line at the time of purchase.
+type RefundItem struct {
+	ID           uint      `gorm:"primary_key" json:"id"`
+	RefundID     uint      `json:"refund_id"`
+	LogProductID uint      `json:"log_product_id"`
+	ProductID    uint      `json:"product_id"`
+	Quantity     uint      `json:"quantity"`
+	Price        uint      `json:"price"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
-func createUser(user User) error {
-	db, err := connectDB()
-	defer db.Close()
+// Subtotal returns the price of the line at the time of purchase.
+func (l LogProduct) Subtotal() uint {
+	return l.Price * l.Quantity
+}
 
-	if err != nil {
-		return err
-	}
+// Subtotal returns the refunded price of the line.
+func (i RefundItem) Subtotal() uint {
+	return i.Price * i.Quantity
+}
 
-	if isEmailExist(user.Email) {
-		return errors.New("Email already exists")
+// RefundedAmount returns the sum of the approved refunds of the transaction,
+// including the ones still being paid back.
+func (t *Transaction) RefundedAmount() uint {
+	var amount uint
+	for _, refund := range t.Refunds {
+		if refund.inLedger() {
+			amount += refund.Amount
+		}
 	}
+	return amount
+}
 
-	if isPhoneExist(user.Phone) {
-		return errors.New("Phone already exists")
-	}
+// CartItem is a product in the cart of a user. It has no price: the cart is
+// always priced from the current Product.Price.
+type CartItem struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	UserID    uint      `json:"user_id"`
+	ProductID uint      `json:"product_id"`
+	Quantity  uint      `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
 
-	if result := db.Exec("INSERT INTO users(name, email, phone, password) VALUES (?, ?, ?, ?)", user.Name, user.Email, user.Phone, user.Password); result.Error != nil {
-		return result.Error
-	}
+type RefreshToken struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	UserID    uint       `json:"user_id"`
+	FamilyID  string     `json:"family_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"unique"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
 
-	return nil
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"unique"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
-func getUserByEmail(email string) (*User, error) {
-	db, err := connectDB()
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
+type LoginAttempt struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	Email     string    `json:"email" gorm:"index"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
 
-	var user User
-	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, err
-	}
-	return &user, nil
+type RecoveryCode struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// TOTPStep is the last TOTP time step accepted for a user. Codes of that
+// step or earlier are rejected so a code cannot be used twice.
+type TOTPStep struct {
+	UserID    uint      `gorm:"primary_key;auto_increment:false" json:"user_id"`
+	Step      int64     `json:"step"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type VerificationCode struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	Channel   string     `json:"channel"`
+	Target    string     `json:"target"`
+	CodeHash  string     `json:"-"`
+	Attempts  uint       `json:"attempts"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// IdempotencyKey stores the response to the first request a user sent with
+// an Idempotency-Key, so retries get the same response.
+type IdempotencyKey struct {
+	ID     uint   `gorm:"primary_key" json:"id"`
+	UserID uint   `json:"user_id"`
+	Key    string `json:"key" gorm:"column:idempotency_key"`
+	// RequestHash identifies the method, path and body of the request.
+	RequestHash string `json:"-"`
+	// StatusCode is 0 while the first request is still being handled.
+	StatusCode int `json:"status_code"`
+	// LockedUntil is when a request still being handled is considered dead,
+	// e.g. because the process crashed; another request may reclaim the key
+	// then. It is nil once the response is stored.
+	LockedUntil  *time.Time `json:"locked_until"`
+	ContentType  string     `json:"-"`
+	ResponseBody string     `json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (s *Server) generateToken(userID int64) (string, error) {
+	return s.tokens.Issue(jwt.MapClaims{"user_id": userID, "typ": tokenTypeAccess}, s.tokens.accessTTL)
 }
 
-func generateToken(userID int64) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = userID
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
-	tokenString, err := token.SignedString([]byte("secret"))
+// pathID parses the {id} path parameter. It writes a 400 carrying message and
+// returns false when the parameter is not a valid ID.
+func pathID(w http.ResponseWriter, r *http.Request, message string) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
-		return "", err
+		writeError(w, r, newAPIError(http.StatusBadRequest, message))
+		return 0, false
 	}
-	return tokenString, nil
+	return uint(id), true
 }
 
-func registerHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) registerHandler(w http.ResponseWriter, r *http.Request) {
 	// ambil data yang diberikan oleh user pada body request
-	var user User
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req registerRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
+	user := User{Name: req.Name, Email: req.Email, Phone: req.Phone, Password: req.Password, Role: RoleBuyer}
 
 	// cek apakah email atau no telepon sudah terdaftar
-	if isEmailExist(user.Email) {
-		http.Error(w, "Email already exist", http.StatusBadRequest)
+	if exists, err := s.repo.Users.EmailExists(user.Email); err != nil || exists {
+		writeError(w, r, conflictOr(err, "Email already exists"))
 		return
 	}
-	if isPhoneExist(user.Phone) {
-		http.Error(w, "Phone already exist", http.StatusBadRequest)
+	if exists, err := s.repo.Users.PhoneExists(user.Phone); err != nil || exists {
+		writeError(w, r, conflictOr(err, "Phone already exists"))
 		return
 	}
 
 	// hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	user.Password = string(hashedPassword)
 
 	// simpan data user ke database
-	err = createUser(user)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := s.repo.Users.Create(&user); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
+	// kirim kode verifikasi email dan no telepon
+	s.sendInitialVerificationCodes(&user)
+
 	// kirim response ke user
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "User created"})
+	writeJSON(w, http.StatusCreated, map[string]string{"message": "User created"})
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 	// ambil data yang diberikan oleh user pada body request
-	var user User
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var user loginRequest
+	if !decodeAndValidate(w, r, &user) {
+		return
+	}
+
+	// tolak percobaan login jika akun atau IP sedang di-backoff / dikunci
+	if !s.checkLoginAllowed(w, r, user.Email) {
 		return
 	}
 
 	// cek apakah email atau no telepon terdaftar
-	userData, err := getUserByEmail(user.Email)
+	userData, err := s.repo.Users.FindByEmail(user.Email)
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusBadRequest)
+		s.recordLoginFailure(r, user.Email, "unknown_email")
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid email or password"))
 		return
 	}
 
 	// bandingkan password yang diberikan oleh user dengan password yang tersimpan di database
 	err = bcrypt.CompareHashAndPassword([]byte(userData.Password), []byte(user.Password))
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusBadRequest)
+		s.recordLoginFailure(r, user.Email, "invalid_password")
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid email or password"))
 		return
 	}
 
-	// generate token JWT
-	token, err := generateToken(int64(userData.ID))
+	// jika 2FA aktif, user harus menukar challenge token dengan kode TOTP.
+	// Counter gagal login baru di-reset setelah kode TOTP benar, agar
+	// password yang benar tidak membuka kesempatan menebak kode tanpa batas
+	if userData.TOTPEnabled {
+		mfaToken, err := s.generateMFAChallengeToken(userData.ID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, mfaChallengeResponse{MFARequired: true, MFAToken: mfaToken})
+		return
+	}
+	s.recordLoginSuccess(user.Email)
+
+	// generate access token dan refresh token
+	tokenPair, err := s.issueSession(userData.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	// kirim response ke user
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	writeJSON(w, http.StatusOK, tokenPair)
 }
 
-func getAccountHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getAccountHandler(w http.ResponseWriter, r *http.Request) {
 	// Mendapatkan user dari token JWT
-	user := r.Context().Value("user").(*User)
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
 
 	// Menampilkan data user
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, http.StatusOK, newUserResponse(user))
 }
 
-func updateAccountHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) updateAccountHandler(w http.ResponseWriter, r *http.Request) {
 	// Mendapatkan user dari token JWT
-	user := r.Context().Value("user").(*User)
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
 
 	// Mengambil data yang diberikan oleh user pada body request
-	var updatedUser User
-	err := json.NewDecoder(r.Body).Decode(&updatedUser)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var updatedUser updateAccountRequest
+	if !decodeAndValidate(w, r, &updatedUser) {
 		return
 	}
 
+	// Email atau no telepon yang berubah harus diverifikasi ulang
+	if updatedUser.Email != user.Email {
+		user.EmailVerifiedAt = nil
+	}
+	if updatedUser.Phone != user.Phone {
+		user.PhoneVerifiedAt = nil
+	}
+
 	// Memperbarui data user
 	user.Name = updatedUser.Name
 	user.Email = updatedUser.Email
 	user.Phone = updatedUser.Phone
 
-	DB.Save(user)
+	if err := s.repo.Users.Update(user); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
 	// Menampilkan data user yang telah diperbarui
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, http.StatusOK, newUserResponse(user))
 }
 
-func createAddressHandler(w http.ResponseWriter, r *http.Request) {
-	// Dekode request body ke dalam objek model `Address`
-	var address Address
-	if err := json.NewDecoder(r.Body).Decode(&address); err != nil {
-		// Jika terjadi masalah saat dekode request body, kirim pesan kesalahan dengan status 400 Bad Request
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Gagal memproses request body: %v", err)
+func (s *Server) createAddressHandler(w http.ResponseWriter, r *http.Request) {
+	// Dekode request body ke dalam DTO `addressRequest`
+	var req addressRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
+	// Alamat selalu dimiliki oleh user yang sedang login
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	address := Address{UserID: user.ID}
+	req.applyTo(&address)
+
 	// Simpan alamat baru ke dalam database
-	if err := DB.Create(&address).Error; err != nil {
-		// Jika terjadi masalah saat menyimpan data, kirim pesan kesalahan dengan status 500 Internal Server Error
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Gagal menyimpan alamat baru: %v", err)
+	if err := s.repo.Addresses.Create(&address); err != nil {
+		// Jika terjadi masalah saat menyimpan data, kirim pesan kesalahan
+		writeError(w, r, err)
 		return
 	}
 
 	// Jika penyimpanan berhasil, kirim response dengan status 201 Created dan data alamat yang baru saja ditambahkan
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(address)
+	writeJSON(w, http.StatusCreated, newAddressResponse(&address))
 }
 
-func getAddressHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getAddressHandler(w http.ResponseWriter, r *http.Request) {
 	// Dapatkan id dari URL parameter
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id, ok := pathID(w, r, "Invalid address ID")
+	if !ok {
+		return
+	}
 
-	// Inisialisasi objek model `Address`
-	var address Address
+	// Hanya alamat milik user yang sedang login yang dapat diakses
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
 
 	// Cari alamat dengan id yang diberikan dari database
-	if err := DB.First(&address, id).Error; err != nil {
+	address, err := s.repo.Addresses.FindForUser(user, id)
+	if err != nil {
 		// Jika alamat tidak ditemukan, kirim pesan kesalahan dengan status 404 Not Found
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Alamat dengan id %s tidak ditemukan", id)
+		writeError(w, r, notFoundOr(err, "Address not found"))
 		return
 	}
 
 	// Jika alamat ditemukan, kirim response dengan data alamat yang ditemukan
-	json.NewEncoder(w).Encode(address)
+	writeJSON(w, http.StatusOK, newAddressResponse(address))
 }
 
-// Get user ID from JWT
-func getUserIdFromToken(w http.ResponseWriter, r *http.Request) int {
-	// Parse JWT from Authorization header
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
-		return 0
-	}
-	tokenString = strings.ReplaceAll(tokenString, "Bearer ", "")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte("my-secret-key"), nil
-	})
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return 0
-	}
-
-	// Get user ID from token claims
-	claims, ok := token.Claims.(jwt.MapClaims)
+func (s *Server) updateAddressHandler(w http.ResponseWriter, r *http.Request) {
+	// get user from JWT token
+	user, ok := userFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return 0
-	}
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return 0
-	}
-
-	return int(userID)
-}
-
-type contextKey string
-
-const (
-	authContextKey contextKey = "auth"
-)
-
-func updateAddressHandler(w http.ResponseWriter, r *http.Request) {
-	// get user ID from JWT token
-	claims, ok := r.Context().Value(authContextKey).(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "invalid token", http.StatusUnauthorized)
-		return
-	}
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		http.Error(w, "invalid token", http.StatusUnauthorized)
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "invalid token"))
 		return
 	}
 
@@ -459,413 +590,445 @@ func updateAddressHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	addressID, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		http.Error(w, "invalid address ID", http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, "invalid address ID"))
 		return
 	}
 
-	// parse JSON request body into Address struct
-	var address Address
-	err = json.NewDecoder(r.Body).Decode(&address)
-	if err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	// parse JSON request body into addressRequest DTO
+	var req addressRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	// validate user ID
-	if uint(userID) != address.UserID {
-		http.Error(w, "you are not authorized to update this address", http.StatusUnauthorized)
+	// only addresses owned by the user are visible, others are reported as not found
+	existingAddress, err := s.repo.Addresses.FindForUser(user, uint(addressID))
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Address not found"))
 		return
 	}
 
 	// update address in database
-	db, err := connectDB()
-	defer db.Close()
-
-	var existingAddress Address
-	err = db.Where("id = ?", addressID).First(&existingAddress).Error
+	req.applyTo(existingAddress)
+	err = s.repo.Addresses.Update(existingAddress)
 	if err != nil {
-		http.Error(w, "address not found", http.StatusNotFound)
-		return
-	}
-	existingAddress.Name = address.Name
-	existingAddress.Street = address.Street
-	existingAddress.City = address.City
-	existingAddress.Province = address.Province
-	existingAddress.Zipcode = address.Zipcode
-	err = db.Save(&existingAddress).Error
-	if err != nil {
-		http.Error(w, "failed to update address", http.StatusInternalServerError)
+		writeError(w, r, newAPIError(http.StatusInternalServerError, "failed to update address"))
 		return
 	}
 
 	// return updated address in response
-	json.NewEncoder(w).Encode(existingAddress)
+	writeJSON(w, http.StatusOK, newAddressResponse(existingAddress))
 }
 
-func deleteAddressHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) deleteAddressHandler(w http.ResponseWriter, r *http.Request) {
 	// Dapatkan id dari URL parameter
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id, ok := pathID(w, r, "Invalid address ID")
+	if !ok {
+		return
+	}
 
-	// Inisialisasi objek model `Address`
-	var address Address
+	// Hanya alamat milik user yang sedang login yang dapat diakses
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
 
 	// Cari alamat dengan id yang diberikan dari database
-	if err := DB.First(&address, id).Error; err != nil {
+	address, err := s.repo.Addresses.FindForUser(user, id)
+	if err != nil {
 		// Jika alamat tidak ditemukan, kirim pesan kesalahan dengan status 404 Not Found
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Alamat dengan id %s tidak ditemukan", id)
+		writeError(w, r, notFoundOr(err, "Address not found"))
 		return
 	}
 
 	// Hapus alamat dari database
-	if err := DB.Delete(&address).Error; err != nil {
-		// Jika terjadi masalah saat menghapus, kirim pesan kesalahan dengan status 500 Internal Server Error
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Gagal menghapus alamat dengan id %s: %v", id, err)
+	if err := s.repo.Addresses.Delete(address); err != nil {
+		// Jika terjadi masalah saat menghapus, kirim pesan kesalahan
+		writeError(w, r, err)
 		return
 	}
 
 	// Send a success response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Address deleted"})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Address deleted"})
 }
 
-func createCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse request body to Category struct
-	var category Category
-	err := json.NewDecoder(r.Body).Decode(&category)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+func (s *Server) createCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body to categoryRequest DTO
+	var req categoryRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
+	var category Category
+	req.applyTo(&category)
 
-	// Save Category to database using ORM
-	result := DB.Create(&category)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	// Save Category to database
+	if err := s.repo.Categories.Create(&category); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	// Return JSON response with created Category object
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(category)
+	writeJSON(w, http.StatusCreated, newCategoryResponse(&category))
 }
 
-func getCategoryListHandler(w http.ResponseWriter, r *http.Request) {
-	// Query all Category objects from database using ORM
-	var categories []Category
-	result := DB.Find(&categories)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+func (s *Server) getCategoryListHandler(w http.ResponseWriter, r *http.Request) {
+	// Query all Category objects from database
+	categories, err := s.repo.Categories.List()
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	// Return JSON response with list of Category objects
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(categories)
+	writeJSON(w, http.StatusOK, newCategoryListResponse(categories))
 }
 
-func getCategoryHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	// Get category ID from URL path parameter
 	vars := mux.Vars(r)
 	categoryID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid category ID"))
 		return
 	}
 
-	// Query Category object from database using ORM
-	var category Category
-	result := DB.First(&category, categoryID)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusNotFound)
+	// Query Category object from database
+	category, err := s.repo.Categories.FindByID(uint(categoryID))
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Category not found"))
 		return
 	}
 
 	// Return JSON response with Category object
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(category)
+	writeJSON(w, http.StatusOK, newCategoryResponse(category))
 }
 
-func updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	// Get category ID from URL path parameter
 	vars := mux.Vars(r)
 	categoryID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid category ID"))
 		return
 	}
 
-	// Parse request body to Category struct
-	var category Category
-	err = json.NewDecoder(r.Body).Decode(&category)
+	// Parse request body to categoryRequest DTO
+	var req categoryRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	// Find existing Category object in database
+	category, err := s.repo.Categories.FindByID(uint(categoryID))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, notFoundOr(err, "Category not found"))
 		return
 	}
 
-	// Update Category object in database using ORM
-	result := DB.Model(&Category{}).Where("id = ?", categoryID).Updates(category)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	// Update Category object in database
+	req.applyTo(category)
+	if err := s.repo.Categories.Update(category); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	// Return JSON response with updated Category object
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(category)
+	writeJSON(w, http.StatusOK, newCategoryResponse(category))
 }
 
-func deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	// ambil id kategori dari path parameter
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid category ID"))
 		return
 	}
 
 	// hapus kategori dari database
-	category := Category{ID: uint(id)}
-	if err := DB.Delete(&category).Error; err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if err := s.repo.Categories.Delete(uint(id)); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	// kirim status sukses ke client
-	w.WriteHeader(http.StatusOK)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Category deleted"})
 }
 
-func createProductHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) createProductHandler(w http.ResponseWriter, r *http.Request) {
 	// Ambil data dari request body
-	var product Product
-	err := json.NewDecoder(r.Body).Decode(&product)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req productRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	// Lakukan validasi data produk
-	if product.Name == "" {
-		http.Error(w, "Product name is required", http.StatusBadRequest)
+	// Produk selalu dimiliki oleh seller yang sedang login
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
 		return
 	}
+	// Kategori harus ada; tanpa cek ini foreign key baru gagal saat insert
+	if _, err := s.repo.Categories.FindByID(req.CategoryID); err != nil {
+		writeError(w, r, notFoundOr(err, "Category not found"))
+		return
+	}
+	product := Product{UserID: user.ID}
+	req.applyTo(&product)
 
 	// Simpan data produk ke database
-	err = DB.Create(&product).Error
+	err := s.repo.Products.Create(&product)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	// Kirim response dengan data produk yang baru saja dibuat
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(product)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	writeJSON(w, http.StatusCreated, newProductResponse(&product))
 }
 
-func getProductListHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getProductListHandler(w http.ResponseWriter, r *http.Request) {
 	// Ambil data produk dari database
-	var products []Product
-	err := DB.Find(&products).Error
+	products, err := s.repo.Products.List()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	// Kirim response dengan data produk
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(products)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	writeJSON(w, http.StatusOK, newProductListResponse(products))
 }
 
-func getProductHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getProductHandler(w http.ResponseWriter, r *http.Request) {
 	// Ambil ID produk dari URL parameter
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid product ID"))
 		return
 	}
 
 	// Ambil data produk dari database
-	var product Product
-	err = DB.First(&product, id).Error
+	product, err := s.repo.Products.FindByID(uint(id))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			http.Error(w, "Product not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeError(w, r, notFoundOr(err, "Product not found"))
 		return
 	}
 
 	// Kirim response dengan data produk
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(product)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	writeJSON(w, http.StatusOK, newProductResponse(product))
+}
+
+func (s *Server) updateProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "Invalid product ID")
+	if !ok {
 		return
 	}
-}
 
-func updateProductHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	productID := vars["id"]
+	// Only the owner of the product (or an admin) can modify it
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
 
 	// Check if product exists
-	var product Product
-	result := DB.First(&product, productID)
-	if result.Error != nil {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Product not found")
+	product, err := s.repo.Products.FindForUser(user, productID)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Product not found"))
 		return
 	}
 
-	// Decode request body into Product struct
-	var updatedProduct Product
-	err := json.NewDecoder(r.Body).Decode(&updatedProduct)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Invalid request payload")
+	// Decode request body into productRequest DTO
+	var req productRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if _, err := s.repo.Categories.FindByID(req.CategoryID); err != nil {
+		writeError(w, r, notFoundOr(err, "Category not found"))
 		return
 	}
 
 	// Update product fields
-	product.Name = updatedProduct.Name
-	product.Description = updatedProduct.Description
-	product.Price = updatedProduct.Price
-	product.Image = updatedProduct.Image
-	product.Stock = updatedProduct.Stock
+	req.applyTo(product)
 	product.UpdatedAt = time.Now()
 
 	// Save changes to database
-	DB.Save(&product)
+	if err := s.repo.Products.Update(product); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
 	// Return updated product as JSON
-	json.NewEncoder(w).Encode(&product)
+	writeJSON(w, http.StatusOK, newProductResponse(product))
 }
 
-func deleteProductHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	productID := vars["id"]
+func (s *Server) deleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, ok := pathID(w, r, "Invalid product ID")
+	if !ok {
+		return
+	}
+
+	// Only the owner of the product (or an admin) can modify it
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
 
 	// Check if product exists
-	var product Product
-	result := DB.First(&product, productID)
-	if result.Error != nil {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Product not found")
+	product, err := s.repo.Products.FindForUser(user, productID)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Product not found"))
 		return
 	}
 
 	// Delete product from database
-	DB.Delete(&product)
+	if err := s.repo.Products.Delete(product); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
 	// Return success message
-	fmt.Fprintf(w, "Product deleted")
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Product deleted"})
 }
 
-func createTransactionHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse request body to Transaction struct
-	var transaction Transaction
-	err := json.NewDecoder(r.Body).Decode(&transaction)
+// newTransaction returns an order of the user for items. Every item carries
+// the price at the time of purchase, and the total is computed from them.
+func newTransaction(userID, addressID uint, items []LogProduct) Transaction {
+	var total uint
+	for _, item := range items {
+		total += item.Subtotal()
+	}
+	return Transaction{
+		UserID:          userID,
+		Status:          StatusPendingPayment,
+		TotalPrice:      total,
+		AddressID:       addressID,
+		TransactionTime: time.Now(),
+		Items:           items,
+	}
+}
+
+// priceItems turns the requested items into transaction lines priced with
+// the current product prices. Repeated products are merged into one line.
+func (s *Server) priceItems(reqItems []transactionItemRequest) ([]LogProduct, error) {
+	var items []LogProduct
+	index := map[uint]int{}
+	for _, req := range reqItems {
+		if i, ok := index[req.ProductID]; ok {
+			items[i].Quantity += req.Quantity
+			continue
+		}
+		index[req.ProductID] = len(items)
+		items = append(items, LogProduct{ProductID: req.ProductID, Quantity: req.Quantity})
+	}
+
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ProductID
+	}
+	products, err := s.repo.Products.FindByIDs(ids)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+	prices := make(map[uint]uint, len(products))
+	for _, product := range products {
+		prices[product.ID] = product.Price
+	}
+
+	for i := range items {
+		price, ok := prices[items[i].ProductID]
+		if !ok {
+			return nil, newAPIError(http.StatusNotFound, fmt.Sprintf("Product %d not found", items[i].ProductID))
+		}
+		items[i].Price = price
+	}
+	return items, nil
+}
+
+func (s *Server) createTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body to createTransactionRequest DTO
+	var req createTransactionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	// Transaction always belongs to the authenticated buyer
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
 		return
 	}
 
-	// Insert transaction to database
-	err = DB.Create(&transaction).Error
+	// Shipping address must belong to the buyer
+	address, err := s.repo.Addresses.FindForUser(user, req.AddressID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, notFoundOr(err, "Address not found"))
 		return
 	}
 
-	// Return success response
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(transaction)
-}
+	// Prices are taken from the products, never trusted from the client
+	items, err := s.priceItems(req.Items)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	transaction := newTransaction(user.ID, address.ID, items)
 
-func getTransactionListHandler(w http.ResponseWriter, r *http.Request) {
-	// Retrieve all transactions from database
-	var transactions []Transaction
-	err := DB.Find(&transactions).Error
+	// Insert transaction and its items to database
+	err = s.repo.Transactions.Create(&transaction)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	// Return transactions as response
-	json.NewEncoder(w).Encode(transactions)
+	// Return success response
+	writeJSON(w, http.StatusCreated, newTransactionResponse(&transaction))
 }
 
-func getTransactionHandler(w http.ResponseWriter, r *http.Request) {
-	// Mendapatkan nilai id dari path parameter
-	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 64)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+func (s *Server) getTransactionListHandler(w http.ResponseWriter, r *http.Request) {
+	// Only transactions of the buyer or the seller are listed
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
 		return
 	}
 
-	// Mencari transaksi dengan id yang sesuai dari database
-	var transaction Transaction
-	err = DB.First(&transaction, id).Error
+	// Retrieve all transactions from database
+	transactions, err := s.repo.Transactions.ListForUser(user)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	// Mengembalikan response dengan data transaksi yang ditemukan
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(transaction)
+	// Return transactions as response
+	writeJSON(w, http.StatusOK, newTransactionListResponse(transactions))
 }
 
-func confirmTransactionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	// Mendapatkan nilai id dari path parameter
 	vars := mux.Vars(r)
 	id, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid transaction ID"))
 		return
 	}
 
-	// Mencari transaksi dengan id yang sesuai dari database
-	var transaction Transaction
-	err = DB.First(&transaction, id).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		w.WriteHeader(http.StatusInternalServerError)
+	// Transaksi milik user lain dianggap tidak ditemukan
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
 		return
 	}
 
-	// Mengubah status transaksi menjadi "confirmed"
-	transaction.Status = "confirmed"
-	err = DB.Save(&transaction).Error
+	// Mencari transaksi dengan id yang sesuai dari database
+	transaction, err := s.repo.Transactions.FindForUser(user, uint(id))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, notFoundOr(err, "Transaction not found"))
 		return
 	}
 
-	// Mengembalikan response dengan data transaksi yang telah diubah statusnya
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(transaction)
+	// Mengembalikan response dengan data transaksi yang ditemukan
+	writeJSON(w, http.StatusOK, newTransactionResponse(transaction))
 }
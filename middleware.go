@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type contextKey string
+
+const (
+	authContextKey contextKey = "auth"
+	userContextKey contextKey = "user"
+)
+
+// authMiddleware validates the Bearer token, loads the owning User from the
+// database and stores both the user and the token claims in the request context.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Parse JWT from Authorization header
+		tokenString, ok := bearerToken(r)
+		if !ok {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, "Missing Authorization header"))
+			return
+		}
+		claims, err := s.parseToken(tokenString)
+		if err != nil || claims["typ"] != tokenTypeAccess {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, "Invalid token"))
+			return
+		}
+
+		// Get user ID from token claims
+		userID, ok := claims["user_id"].(float64)
+		if !ok {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, "Invalid token"))
+			return
+		}
+
+		// Load user from database
+		user, err := s.repo.Users.FindByID(uint(userID))
+		if err != nil {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, "Invalid token"))
+			return
+		}
+
+		// Tolak token yang diterbitkan sebelum user logout dari semua perangkat
+		if user.TokensValidAfter != nil && issuedAtMicro(claims) <= user.TokensValidAfter.UnixMicro() {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, "Token has been revoked"))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), authContextKey, claims)
+		ctx = context.WithValue(ctx, userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// bearerToken returns the token from the "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+func (s *Server) parseToken(tokenString string) (jwt.MapClaims, error) {
+	return s.tokens.Parse(tokenString)
+}
+
+// userFromContext returns the authenticated user stored by authMiddleware.
+func userFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userContextKey).(*User)
+	return user, ok
+}
+
+// claimsFromContext returns the JWT claims stored by authMiddleware.
+func claimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(authContextKey).(jwt.MapClaims)
+	return claims, ok
+}
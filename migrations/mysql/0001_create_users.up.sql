@@ -0,0 +1,18 @@
+CREATE TABLE users (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    phone VARCHAR(20) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'buyer',
+    email_verified_at DATETIME NULL,
+    phone_verified_at DATETIME NULL,
+    totp_secret VARCHAR(64) NOT NULL DEFAULT '',
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    tokens_valid_after DATETIME NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uix_users_email (email),
+    UNIQUE KEY uix_users_phone (phone)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+DROP TABLE products;
+DROP TABLE categories;
+DROP TABLE stores;
+DROP TABLE addresses;
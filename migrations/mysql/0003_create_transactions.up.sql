@@ -0,0 +1,34 @@
+CREATE TABLE transactions (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id INT UNSIGNED NOT NULL,
+    product_id INT UNSIGNED NOT NULL,
+    quantity INT UNSIGNED NOT NULL,
+    total_price INT UNSIGNED NOT NULL,
+    address_id INT UNSIGNED NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT '',
+    transaction_time DATETIME NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_transactions_user_id (user_id),
+    KEY idx_transactions_product_id (product_id),
+    KEY idx_transactions_address_id (address_id),
+    CONSTRAINT fk_transactions_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_transactions_product FOREIGN KEY (product_id) REFERENCES products (id),
+    CONSTRAINT fk_transactions_address FOREIGN KEY (address_id) REFERENCES addresses (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE log_products (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    transaction_id INT UNSIGNED NOT NULL,
+    product_id INT UNSIGNED NOT NULL,
+    quantity INT UNSIGNED NOT NULL,
+    price INT UNSIGNED NOT NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_log_products_transaction_id (transaction_id),
+    KEY idx_log_products_product_id (product_id),
+    CONSTRAINT fk_log_products_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE,
+    CONSTRAINT fk_log_products_product FOREIGN KEY (product_id) REFERENCES products (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+DROP TABLE verification_codes;
+DROP TABLE recovery_codes;
+DROP TABLE login_attempts;
+DROP TABLE password_reset_tokens;
+DROP TABLE refresh_tokens;
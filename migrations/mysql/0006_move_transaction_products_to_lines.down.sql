@@ -0,0 +1,9 @@
+-- Transaksi dengan beberapa produk hanya menyimpan baris pertama
+ALTER TABLE transactions ADD COLUMN product_id INT UNSIGNED NULL AFTER user_id, ADD COLUMN quantity INT UNSIGNED NOT NULL DEFAULT 0 AFTER product_id;
+
+UPDATE transactions t
+JOIN log_products l ON l.id = (SELECT MIN(id) FROM log_products WHERE transaction_id = t.id)
+SET t.product_id = l.product_id, t.quantity = l.quantity;
+
+ALTER TABLE transactions ADD KEY idx_transactions_product_id (product_id);
+ALTER TABLE transactions ADD CONSTRAINT fk_transactions_product FOREIGN KEY (product_id) REFERENCES products (id);
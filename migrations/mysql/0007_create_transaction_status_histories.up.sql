@@ -0,0 +1,16 @@
+-- Transaksi lama yang belum dikonfirmasi masuk ke status awal yang baru
+UPDATE transactions SET status = 'pending_payment' WHERE status = '';
+
+CREATE TABLE transaction_status_histories (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    transaction_id INT UNSIGNED NOT NULL,
+    from_status VARCHAR(20) NOT NULL DEFAULT '',
+    to_status VARCHAR(20) NOT NULL,
+    actor_id INT UNSIGNED NOT NULL DEFAULT 0,
+    actor_role VARCHAR(20) NOT NULL,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_transaction_status_histories_transaction_id (transaction_id),
+    CONSTRAINT fk_transaction_status_histories_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,26 @@
+CREATE TABLE payments (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    transaction_id INT UNSIGNED NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    charge_id VARCHAR(64) NOT NULL,
+    amount INT UNSIGNED NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    payment_url VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uix_payments_provider_charge_id (provider, charge_id),
+    KEY idx_payments_transaction_id (transaction_id),
+    CONSTRAINT fk_payments_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE payment_events (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    provider VARCHAR(20) NOT NULL,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    charge_id VARCHAR(64) NOT NULL,
+    created_at DATETIME NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uix_payment_events_provider_event_id (provider, event_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,33 @@
+CREATE TABLE refunds (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    transaction_id INT UNSIGNED NOT NULL,
+    user_id INT UNSIGNED NOT NULL,
+    amount INT UNSIGNED NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    restocked BOOLEAN NOT NULL DEFAULT FALSE,
+    reviewer_id INT UNSIGNED NOT NULL DEFAULT 0,
+    review_note VARCHAR(255) NOT NULL DEFAULT '',
+    reviewed_at DATETIME NULL,
+    provider_refund_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_refunds_transaction_id (transaction_id),
+    CONSTRAINT fk_refunds_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE,
+    CONSTRAINT fk_refunds_user FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE refund_items (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    refund_id INT UNSIGNED NOT NULL,
+    log_product_id INT UNSIGNED NOT NULL,
+    product_id INT UNSIGNED NOT NULL,
+    quantity INT UNSIGNED NOT NULL,
+    price INT UNSIGNED NOT NULL,
+    created_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_refund_items_refund_id (refund_id),
+    CONSTRAINT fk_refund_items_refund FOREIGN KEY (refund_id) REFERENCES refunds (id) ON DELETE CASCADE,
+    CONSTRAINT fk_refund_items_log_product FOREIGN KEY (log_product_id) REFERENCES log_products (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
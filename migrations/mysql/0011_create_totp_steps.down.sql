@@ -0,0 +1 @@
+DROP TABLE totp_steps;
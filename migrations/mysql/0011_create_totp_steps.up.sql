@@ -0,0 +1,7 @@
+CREATE TABLE totp_steps (
+    user_id INT UNSIGNED NOT NULL,
+    step BIGINT NOT NULL,
+    updated_at DATETIME NULL,
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_totp_steps_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
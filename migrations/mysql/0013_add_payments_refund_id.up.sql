@@ -0,0 +1 @@
+ALTER TABLE payments ADD COLUMN refund_id VARCHAR(64) NOT NULL DEFAULT '' AFTER payment_url;
@@ -0,0 +1,32 @@
+CREATE TABLE transactions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    total_price INTEGER NOT NULL,
+    address_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT '',
+    transaction_time TIMESTAMP NULL,
+    created_at TIMESTAMP NULL,
+    updated_at TIMESTAMP NULL,
+    CONSTRAINT fk_transactions_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_transactions_product FOREIGN KEY (product_id) REFERENCES products (id),
+    CONSTRAINT fk_transactions_address FOREIGN KEY (address_id) REFERENCES addresses (id)
+);
+CREATE INDEX idx_transactions_user_id ON transactions (user_id);
+CREATE INDEX idx_transactions_product_id ON transactions (product_id);
+CREATE INDEX idx_transactions_address_id ON transactions (address_id);
+
+CREATE TABLE log_products (
+    id SERIAL PRIMARY KEY,
+    transaction_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    created_at TIMESTAMP NULL,
+    updated_at TIMESTAMP NULL,
+    CONSTRAINT fk_log_products_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE,
+    CONSTRAINT fk_log_products_product FOREIGN KEY (product_id) REFERENCES products (id)
+);
+CREATE INDEX idx_log_products_transaction_id ON log_products (transaction_id);
+CREATE INDEX idx_log_products_product_id ON log_products (product_id);
@@ -0,0 +1,10 @@
+-- Transaksi dengan beberapa produk hanya menyimpan baris pertama
+ALTER TABLE transactions ADD COLUMN product_id INTEGER NULL, ADD COLUMN quantity INTEGER NOT NULL DEFAULT 0;
+
+UPDATE transactions t
+SET product_id = l.product_id, quantity = l.quantity
+FROM log_products l
+WHERE l.id = (SELECT MIN(id) FROM log_products WHERE transaction_id = t.id);
+
+ALTER TABLE transactions ADD CONSTRAINT fk_transactions_product FOREIGN KEY (product_id) REFERENCES products (id);
+CREATE INDEX idx_transactions_product_id ON transactions (product_id);
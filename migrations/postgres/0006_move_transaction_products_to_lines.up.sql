@@ -0,0 +1,8 @@
+-- Produk dan jumlah dipindah ke log_products agar satu transaksi bisa berisi banyak produk
+INSERT INTO log_products (transaction_id, product_id, quantity, price, created_at, updated_at)
+SELECT t.id, t.product_id, t.quantity, CASE WHEN t.quantity > 0 THEN t.total_price / t.quantity ELSE t.total_price END, t.created_at, t.updated_at
+FROM transactions t
+WHERE NOT EXISTS (SELECT 1 FROM log_products l WHERE l.transaction_id = t.id);
+
+DROP INDEX idx_transactions_product_id;
+ALTER TABLE transactions DROP COLUMN product_id, DROP COLUMN quantity;
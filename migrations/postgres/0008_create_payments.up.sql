@@ -0,0 +1,24 @@
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    transaction_id INTEGER NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    charge_id VARCHAR(64) NOT NULL,
+    amount INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    payment_url VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NULL,
+    updated_at TIMESTAMP NULL,
+    CONSTRAINT fk_payments_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX uix_payments_provider_charge_id ON payments (provider, charge_id);
+CREATE INDEX idx_payments_transaction_id ON payments (transaction_id);
+
+CREATE TABLE payment_events (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(20) NOT NULL,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    charge_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NULL
+);
+CREATE UNIQUE INDEX uix_payment_events_provider_event_id ON payment_events (provider, event_id);
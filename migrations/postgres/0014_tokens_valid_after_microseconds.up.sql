@@ -0,0 +1 @@
+-- TIMESTAMP sudah menyimpan mikrodetik, tidak ada yang perlu diubah
@@ -0,0 +1,2 @@
+DROP TABLE log_products;
+DROP TABLE transactions;
@@ -0,0 +1,44 @@
+-- Transaksi dengan beberapa produk hanya menyimpan baris pertama
+CREATE TABLE log_products_backup AS SELECT * FROM log_products;
+DROP TABLE log_products;
+
+CREATE TABLE transactions_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    product_id INTEGER NULL,
+    quantity INTEGER NOT NULL DEFAULT 0,
+    total_price INTEGER NOT NULL,
+    address_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT '',
+    transaction_time DATETIME NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_transactions_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_transactions_product FOREIGN KEY (product_id) REFERENCES products (id),
+    CONSTRAINT fk_transactions_address FOREIGN KEY (address_id) REFERENCES addresses (id)
+);
+INSERT INTO transactions_old (id, user_id, product_id, quantity, total_price, address_id, status, transaction_time, created_at, updated_at)
+SELECT t.id, t.user_id, l.product_id, COALESCE(l.quantity, 0), t.total_price, t.address_id, t.status, t.transaction_time, t.created_at, t.updated_at
+FROM transactions t
+LEFT JOIN log_products_backup l ON l.id = (SELECT MIN(id) FROM log_products_backup WHERE transaction_id = t.id);
+DROP TABLE transactions;
+ALTER TABLE transactions_old RENAME TO transactions;
+CREATE INDEX idx_transactions_user_id ON transactions (user_id);
+CREATE INDEX idx_transactions_product_id ON transactions (product_id);
+CREATE INDEX idx_transactions_address_id ON transactions (address_id);
+
+CREATE TABLE log_products (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_log_products_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE,
+    CONSTRAINT fk_log_products_product FOREIGN KEY (product_id) REFERENCES products (id)
+);
+INSERT INTO log_products SELECT * FROM log_products_backup;
+DROP TABLE log_products_backup;
+CREATE INDEX idx_log_products_transaction_id ON log_products (transaction_id);
+CREATE INDEX idx_log_products_product_id ON log_products (product_id);
@@ -0,0 +1,45 @@
+-- Produk dan jumlah dipindah ke log_products agar satu transaksi bisa berisi banyak produk
+INSERT INTO log_products (transaction_id, product_id, quantity, price, created_at, updated_at)
+SELECT t.id, t.product_id, t.quantity, CASE WHEN t.quantity > 0 THEN t.total_price / t.quantity ELSE t.total_price END, t.created_at, t.updated_at
+FROM transactions t
+WHERE NOT EXISTS (SELECT 1 FROM log_products l WHERE l.transaction_id = t.id);
+
+-- SQLite tidak bisa menghapus kolom dengan foreign key, jadi tabel dibuat ulang.
+-- log_products disalin dulu karena DROP TABLE transactions akan men-cascade ke sana.
+CREATE TABLE log_products_backup AS SELECT * FROM log_products;
+DROP TABLE log_products;
+
+CREATE TABLE transactions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    total_price INTEGER NOT NULL,
+    address_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT '',
+    transaction_time DATETIME NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_transactions_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_transactions_address FOREIGN KEY (address_id) REFERENCES addresses (id)
+);
+INSERT INTO transactions_new (id, user_id, total_price, address_id, status, transaction_time, created_at, updated_at)
+SELECT id, user_id, total_price, address_id, status, transaction_time, created_at, updated_at FROM transactions;
+DROP TABLE transactions;
+ALTER TABLE transactions_new RENAME TO transactions;
+CREATE INDEX idx_transactions_user_id ON transactions (user_id);
+CREATE INDEX idx_transactions_address_id ON transactions (address_id);
+
+CREATE TABLE log_products (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_log_products_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE,
+    CONSTRAINT fk_log_products_product FOREIGN KEY (product_id) REFERENCES products (id)
+);
+INSERT INTO log_products SELECT * FROM log_products_backup;
+DROP TABLE log_products_backup;
+CREATE INDEX idx_log_products_transaction_id ON log_products (transaction_id);
+CREATE INDEX idx_log_products_product_id ON log_products (product_id);
@@ -0,0 +1,4 @@
+DROP TABLE transaction_status_histories;
+
+-- Status baru selain pending_payment dan confirmed tidak punya padanan lama dan dibiarkan
+UPDATE transactions SET status = '' WHERE status = 'pending_payment';
@@ -0,0 +1,15 @@
+-- Transaksi lama yang belum dikonfirmasi masuk ke status awal yang baru
+UPDATE transactions SET status = 'pending_payment' WHERE status = '';
+
+CREATE TABLE transaction_status_histories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL,
+    from_status VARCHAR(20) NOT NULL DEFAULT '',
+    to_status VARCHAR(20) NOT NULL,
+    actor_id INTEGER NOT NULL DEFAULT 0,
+    actor_role VARCHAR(20) NOT NULL,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NULL,
+    CONSTRAINT fk_transaction_status_histories_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_transaction_status_histories_transaction_id ON transaction_status_histories (transaction_id);
@@ -0,0 +1,31 @@
+CREATE TABLE refunds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    restocked BOOLEAN NOT NULL DEFAULT FALSE,
+    reviewer_id INTEGER NOT NULL DEFAULT 0,
+    review_note VARCHAR(255) NOT NULL DEFAULT '',
+    reviewed_at DATETIME NULL,
+    provider_refund_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_refunds_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE,
+    CONSTRAINT fk_refunds_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX idx_refunds_transaction_id ON refunds (transaction_id);
+
+CREATE TABLE refund_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    refund_id INTEGER NOT NULL,
+    log_product_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    created_at DATETIME NULL,
+    CONSTRAINT fk_refund_items_refund FOREIGN KEY (refund_id) REFERENCES refunds (id) ON DELETE CASCADE,
+    CONSTRAINT fk_refund_items_log_product FOREIGN KEY (log_product_id) REFERENCES log_products (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_refund_items_refund_id ON refund_items (refund_id);
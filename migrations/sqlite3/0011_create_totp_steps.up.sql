@@ -0,0 +1,6 @@
+CREATE TABLE totp_steps (
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    step BIGINT NOT NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_totp_steps_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
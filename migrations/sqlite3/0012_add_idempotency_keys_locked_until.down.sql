@@ -0,0 +1,20 @@
+-- SQLite versi bawaan driver belum bisa DROP COLUMN, jadi tabel dibuat ulang
+CREATE TABLE idempotency_keys_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type VARCHAR(100) NOT NULL DEFAULT '',
+    response_body TEXT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_idempotency_keys_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+INSERT INTO idempotency_keys_new (id, user_id, idempotency_key, request_hash, status_code, content_type, response_body, expires_at, created_at, updated_at)
+SELECT id, user_id, idempotency_key, request_hash, status_code, content_type, response_body, expires_at, created_at, updated_at FROM idempotency_keys;
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_new RENAME TO idempotency_keys;
+CREATE UNIQUE INDEX uix_idempotency_keys_user_id_key ON idempotency_keys (user_id, idempotency_key);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,19 @@
+-- SQLite versi bawaan driver belum bisa DROP COLUMN, jadi tabel dibuat ulang
+CREATE TABLE payments_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    charge_id VARCHAR(64) NOT NULL,
+    amount INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    payment_url VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    CONSTRAINT fk_payments_transaction FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE
+);
+INSERT INTO payments_new (id, transaction_id, provider, charge_id, amount, status, payment_url, created_at, updated_at)
+SELECT id, transaction_id, provider, charge_id, amount, status, payment_url, created_at, updated_at FROM payments;
+DROP TABLE payments;
+ALTER TABLE payments_new RENAME TO payments;
+CREATE UNIQUE INDEX uix_payments_provider_charge_id ON payments (provider, charge_id);
+CREATE INDEX idx_payments_transaction_id ON payments (transaction_id);
@@ -0,0 +1 @@
+-- SQLite menyimpan DATETIME sebagai teks lengkap dengan pecahan detik, tidak ada yang perlu diubah
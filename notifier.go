@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a notification sent to a user.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers e-mails. Production deployments use smtpMailer;
+// fileMailer and logMailer are meant for local use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// newMailer returns an smtpMailer when cfg.SMTP.Host is set, a fileMailer
+// when cfg.MailerFile is set and a logMailer otherwise.
+func newMailer(cfg NotifierConfig) Mailer {
+	if cfg.SMTP.Host != "" {
+		return newSMTPMailer(cfg.SMTP)
+	}
+	if cfg.MailerFile != "" {
+		return &fileMailer{path: cfg.MailerFile}
+	}
+	return logMailer{}
+}
+
+// logMailer writes messages to the standard logger.
+type logMailer struct{}
+
+func (logMailer) Send(msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// smtpMailer sends messages through an SMTP server. net/smtp upgrades the
+// connection with STARTTLS when the server offers it.
+type smtpMailer struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+func newSMTPMailer(cfg SMTPConfig) *smtpMailer {
+	m := &smtpMailer{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		host: cfg.Host,
+		from: cfg.From,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return m
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n",
+		m.from, msg.To, mime.QEncoding.Encode("utf-8", msg.Subject), time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(b.String()))
+}
+
+// fileMailer appends messages to a file, one block per message.
+type fileMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// SMSSender delivers text messages. fileSMSSender and logSMSSender are meant
+// for local use; production deployments use httpSMSSender.
+type SMSSender interface {
+	SendSMS(to, body string) error
+}
+
+// newSMSSender returns an httpSMSSender when cfg.SMSURL is set, a
+// fileSMSSender when cfg.SMSFile is set and a logSMSSender otherwise.
+func newSMSSender(cfg NotifierConfig) SMSSender {
+	if cfg.SMSURL != "" {
+		return &httpSMSSender{url: cfg.SMSURL, token: cfg.SMSToken, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	if cfg.SMSFile != "" {
+		return &fileSMSSender{path: cfg.SMSFile}
+	}
+	return logSMSSender{}
+}
+
+// logSMSSender writes text messages to the standard logger.
+type logSMSSender struct{}
+
+func (logSMSSender) SendSMS(to, body string) error {
+	log.Printf("sms to=%s\n%s", to, body)
+	return nil
+}
+
+// httpSMSSender posts text messages to an SMS gateway as JSON
+// {"to": ..., "body": ...}, authenticated with a bearer token.
+type httpSMSSender struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s *httpSMSSender) SendSMS(to, body string) error {
+	payload, err := json.Marshal(map[string]string{"to": to, "body": body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// fileSMSSender appends text messages to a file, one line per message.
+type fileSMSSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileSMSSender) SendSMS(to, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), to, body)
+	return err
+}
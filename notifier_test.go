@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSMSSender(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sms-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	sender := newSMSSender(NotifierConfig{SMSURL: srv.URL, SMSToken: "sms-token"})
+	if err := sender.SendSMS("081200000001", "Kode verifikasi: 123456"); err != nil {
+		t.Fatal(err)
+	}
+	if got["to"] != "081200000001" || got["body"] != "Kode verifikasi: 123456" {
+		t.Errorf("gateway received %v", got)
+	}
+
+	// Gateway yang menolak request dilaporkan sebagai error
+	rejected := newSMSSender(NotifierConfig{SMSURL: srv.URL, SMSToken: "wrong"})
+	if err := rejected.SendSMS("081200000001", "Kode verifikasi: 123456"); err == nil {
+		t.Error("SendSMS succeeded on a 401 response")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultPasswordResetTTL = time.Hour
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// createPasswordResetToken invalidates older reset tokens of the user and
+// stores the hash of a new one. The plain token is only returned to be sent
+// to the user.
+func (s *Server) createPasswordResetToken(userID uint) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.PasswordResets.Replace(&PasswordResetToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.config.PasswordReset.TTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// resetPassword consumes the reset token and stores the new password hash.
+func (s *Server) resetPassword(token, hashedPassword string) (uint, error) {
+	record, err := s.repo.PasswordResets.FindByHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errInvalidResetToken
+		}
+		return 0, err
+	}
+	if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return 0, errInvalidResetToken
+	}
+
+	if err := s.repo.PasswordResets.Consume(record, hashedPassword); err != nil {
+		return 0, err
+	}
+	return record.UserID, nil
+}
+
+func (s *Server) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	// Permintaan reset dibatasi seperti login. Setiap permintaan dihitung
+	// untuk IP saja, supaya orang lain tidak bisa mengunci akun korban
+	if !s.checkLoginAllowed(w, r, req.Email) {
+		return
+	}
+	if _, err := s.ipLimiter.Fail(clientIP(r)); err != nil {
+		log.Printf("failed to record password reset request: %v", err)
+	}
+
+	// Response selalu sama dan dikirim sebelum email dicari, jadi baik isi
+	// maupun waktunya tidak membocorkan apakah email terdaftar
+	s.background.Add(1)
+	go func(email string) {
+		defer s.background.Done()
+		user, err := s.repo.Users.FindByEmail(email)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("failed to look up user for password reset: %v", err)
+			}
+			return
+		}
+		if err := s.sendPasswordResetEmail(user); err != nil {
+			log.Printf("failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}(req.Email)
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+func (s *Server) sendPasswordResetEmail(user *User) error {
+	token, err := s.createPasswordResetToken(user.ID)
+	if err != nil {
+		return err
+	}
+
+	link := s.config.PasswordReset.URL
+	body := fmt.Sprintf("Hi %s,\n\nUse this token to reset your password: %s\n", user.Name, token)
+	if link != "" {
+		body = fmt.Sprintf("Hi %s,\n\nReset your password here: %s?token=%s\n", user.Name, link, token)
+	}
+	body += fmt.Sprintf("The token expires in %s. If you did not request a reset, ignore this email.\n", s.config.PasswordReset.TTL)
+
+	return s.mailer.Send(Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+func (s *Server) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	// hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	userID, err := s.resetPassword(req.Token, string(hashedPassword))
+	if err != nil {
+		if errors.Is(err, errInvalidResetToken) {
+			writeError(w, r, newAPIError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	// Semua sesi lama tidak berlaku lagi setelah password diganti
+	if err := s.revokeAllSessions(userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset"})
+}
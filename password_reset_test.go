@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// resetTokenPattern matches the token in a password reset e-mail without
+// PASSWORD_RESET_URL.
+var resetTokenPattern = regexp.MustCompile(`reset your password: (\S+)`)
+
+func TestForgotPassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		ts.user("Alice", RoleBuyer)
+
+		// Email terdaftar dan tidak terdaftar dijawab sama persis
+		var known, unknown map[string]string
+		ts.expect(http.StatusAccepted, "POST", "/api/auth/forgot-password", "", forgotPasswordRequest{Email: "alice@example.com"}, &known)
+		ts.expect(http.StatusAccepted, "POST", "/api/auth/forgot-password", "", forgotPasswordRequest{Email: "nobody@example.com"}, &unknown)
+		if known["message"] != unknown["message"] {
+			t.Errorf("responses differ: %q and %q", known["message"], unknown["message"])
+		}
+
+		ts.srv.background.Wait()
+		mail, err := os.ReadFile(ts.srv.config.Notifier.MailerFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(mail), "nobody@example.com") {
+			t.Error("reset e-mail sent to an unknown address")
+		}
+		match := resetTokenPattern.FindStringSubmatch(string(mail))
+		if match == nil {
+			t.Fatalf("no reset token in e-mails:\n%s", mail)
+		}
+
+		ts.expect(http.StatusOK, "POST", "/api/auth/reset-password", "", resetPasswordRequest{Token: match[1], Password: "new-password"}, nil)
+		ts.expect(http.StatusBadRequest, "POST", "/api/auth/reset-password", "", resetPasswordRequest{Token: match[1], Password: "other-password"}, nil)
+		ts.expect(http.StatusOK, "POST", "/api/auth/login", "", loginRequest{Email: "alice@example.com", Password: "new-password"}, nil)
+	})
+}
+
+func TestForgotPasswordIsRateLimited(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		ts.user("Alice", RoleBuyer)
+
+		// Setiap permintaan dihitung untuk IP; setelah enam permintaan
+		// berikutnya harus menunggu backoff
+		for i := 0; i < 6; i++ {
+			ts.expect(http.StatusAccepted, "POST", "/api/auth/forgot-password", "", forgotPasswordRequest{Email: "nobody@example.com"}, nil)
+		}
+		ts.expect(http.StatusTooManyRequests, "POST", "/api/auth/forgot-password", "", forgotPasswordRequest{Email: "alice@example.com"}, nil)
+
+		// Akun yang emailnya dipakai tidak ikut dikunci
+		ts.srv.ipLimiter.Reset("127.0.0.1")
+		ts.expect(http.StatusOK, "POST", "/api/auth/login", "", loginRequest{Email: "alice@example.com", Password: "password123"}, nil)
+	})
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Status of a Payment.
+const (
+	PaymentPending   = "pending"
+	PaymentSucceeded = "succeeded"
+	PaymentFailed    = "failed"
+	// PaymentVoided means the transaction was cancelled before the buyer
+	// paid the charge.
+	PaymentVoided = "voided"
+	// PaymentRefunded means the transaction was refunded in full.
+	PaymentRefunded = "refunded"
+)
+
+// maxWebhookBytes limits the body of a webhook request.
+const maxWebhookBytes = 1 << 20
+
+// createPaymentHandler starts paying a transaction. A pending payment that
+// was already started is returned instead of charging the buyer twice.
+func (s *Server) createPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "Invalid transaction ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	transaction, err := s.repo.Transactions.FindForUser(user, id)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Transaction not found"))
+		return
+	}
+	if transaction.UserID != user.ID {
+		writeError(w, r, newAPIError(http.StatusForbidden, "Only the buyer can pay the transaction"))
+		return
+	}
+	if transaction.Status != StatusPendingPayment {
+		writeError(w, r, newAPIError(http.StatusConflict, "Transaction is not awaiting payment"))
+		return
+	}
+
+	payments, err := s.repo.Payments.ListForTransaction(transaction.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for i := range payments {
+		if payments[i].Status == PaymentPending && payments[i].Amount == transaction.TotalPrice {
+			writeJSON(w, http.StatusOK, newPaymentResponse(&payments[i]))
+			return
+		}
+	}
+
+	charge, err := s.payments.CreateCharge(r.Context(), ChargeRequest{
+		Reference: fmt.Sprintf("transaction-%d", transaction.ID),
+		Amount:    transaction.TotalPrice,
+	})
+	if err != nil {
+		writeError(w, r, fmt.Errorf("create charge: %w", err))
+		return
+	}
+
+	payment := Payment{
+		TransactionID: transaction.ID,
+		Provider:      s.payments.Name(),
+		ChargeID:      charge.ID,
+		Amount:        transaction.TotalPrice,
+		Status:        PaymentPending,
+		PaymentURL:    charge.PaymentURL,
+	}
+	if err := s.repo.Payments.Create(&payment); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newPaymentResponse(&payment))
+}
+
+func (s *Server) getPaymentListHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "Invalid transaction ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	transaction, err := s.repo.Transactions.FindForUser(user, id)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Transaction not found"))
+		return
+	}
+
+	payments, err := s.repo.Payments.ListForTransaction(transaction.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newPaymentListResponse(payments))
+}
+
+// paymentWebhookHandler receives the events of the payment provider. It is
+// public: the signature proves the request comes from the provider.
+// Providers retry until they get a 2xx, so an event that was processed
+// already is acknowledged again without applying it twice.
+func (s *Server) paymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid request body"))
+		return
+	}
+
+	event, err := s.payments.VerifyWebhook(r.Header, body)
+	if errors.Is(err, errInvalidWebhookSignature) {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Invalid webhook signature"))
+		return
+	}
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid webhook event"))
+		return
+	}
+
+	if err := s.handlePaymentEvent(r.Context(), event); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Event processed"})
+}
+
+// simulatePaymentHandler makes the fake provider send the webhook for the
+// outcome of a payment, so the payment flow can be completed locally. It is
+// only routed when the fake provider is used outside prod.
+func (s *Server) simulatePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	fake, ok := s.payments.(*fakePaymentProvider)
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusNotFound, "Payment simulation is not available"))
+		return
+	}
+
+	id, ok := pathID(w, r, "Invalid payment ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req simulatePaymentRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	payment, err := s.repo.Payments.FindByID(id)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Payment not found"))
+		return
+	}
+	// Pembayaran transaksi milik user lain dianggap tidak ditemukan
+	if _, err := s.repo.Transactions.FindForUser(user, payment.TransactionID); err != nil {
+		writeError(w, r, notFoundOr(err, "Payment not found"))
+		return
+	}
+
+	eventID, err := randomToken(12)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	body, header, err := fake.signedWebhook(WebhookEvent{
+		ID:       "fake_evt_" + eventID,
+		Type:     "charge." + req.Result,
+		ChargeID: payment.ChargeID,
+		Amount:   payment.Amount,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Lewat jalur verifikasi yang sama dengan webhook sungguhan
+	event, err := s.payments.VerifyWebhook(header, body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := s.handlePaymentEvent(r.Context(), event); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	payment, err = s.repo.Payments.FindByID(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newPaymentResponse(payment))
+}
+
+// handlePaymentEvent applies a verified webhook event once. Events for
+// unknown charges fail so the provider retries them; unknown event types are
+// acknowledged and ignored. A payment is never marked paid for an amount
+// other than the one charged.
+func (s *Server) handlePaymentEvent(ctx context.Context, event *WebhookEvent) error {
+	provider := s.payments.Name()
+	processed, err := s.repo.Payments.EventProcessed(provider, event.ID)
+	if err != nil || processed {
+		return err
+	}
+
+	payment, err := s.repo.Payments.FindByChargeID(provider, event.ChargeID)
+	if err != nil {
+		return notFoundOr(err, "Payment not found")
+	}
+
+	if (event.Type == EventChargeAuthorized || event.Type == EventChargeSucceeded) && event.Amount != payment.Amount {
+		log.Printf("payment %d: %s event %s has amount %d, charged %d", payment.ID, event.Type, event.ID, event.Amount, payment.Amount)
+		return newAPIError(http.StatusUnprocessableEntity, "Payment amount does not match the charge")
+	}
+
+	switch event.Type {
+	case EventChargeAuthorized:
+		// Charge yang sudah di-void tidak di-capture, jadi tidak ada uang yang masuk
+		if payment.Status == PaymentVoided {
+			break
+		}
+		if payment.Status == PaymentPending {
+			if err := s.payments.Capture(ctx, payment.ChargeID, payment.Amount); err != nil {
+				return fmt.Errorf("capture charge %s: %w", payment.ChargeID, err)
+			}
+		}
+		err = s.markPaymentSucceeded(ctx, payment)
+	case EventChargeSucceeded:
+		err = s.markPaymentSucceeded(ctx, payment)
+	case EventChargeFailed:
+		if payment.Status == PaymentPending {
+			_, err = s.repo.Payments.UpdateStatus(payment, PaymentFailed)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.Payments.RecordEvent(&PaymentEvent{
+		Provider:  provider,
+		EventID:   event.ID,
+		EventType: event.Type,
+		ChargeID:  event.ChargeID,
+	})
+	// Event yang sama bisa diproses bersamaan; perubahan status di atas
+	// bersyarat, jadi cukup satu yang tercatat
+	if err != nil && !isDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+// markPaymentSucceeded marks payment as succeeded and its transaction as
+// paid, or refunds it when the transaction was cancelled. Every change is
+// conditional on the current status, so replaying the event, e.g. after the
+// refund failed, completes what is missing.
+func (s *Server) markPaymentSucceeded(ctx context.Context, payment *Payment) error {
+	// Charge yang di-void tetap bisa lunas jika buyer membayar tepat sebelumnya
+	if payment.Status == PaymentPending || payment.Status == PaymentVoided {
+		if _, err := s.repo.Payments.UpdateStatus(payment, PaymentSucceeded); err != nil {
+			return err
+		}
+	}
+	if payment.Status != PaymentSucceeded {
+		return nil
+	}
+
+	transaction, err := s.repo.Transactions.FindByID(payment.TransactionID)
+	if err != nil {
+		return err
+	}
+	if transaction.Status == StatusCancelled {
+		// Dibatalkan sebelum pembayaran masuk; uangnya harus dikembalikan
+		return s.refundCancelledPayment(ctx, payment)
+	}
+	if transaction.Status != StatusPendingPayment {
+		return nil
+	}
+
+	change, err := planTransition(transaction.Status, StatusPaid, []string{ActorSystem})
+	if err != nil {
+		return err
+	}
+	change.Note = fmt.Sprintf("Payment %s via %s", payment.ChargeID, payment.Provider)
+	err = s.repo.Transactions.ChangeStatus(transaction, change)
+	if !errors.Is(err, errTransactionStatusChanged) {
+		return err
+	}
+	// Status yang berubah bersamaan berarti webhook lain sudah menandainya,
+	// atau transaksi baru saja dibatalkan
+	transaction, err = s.repo.Transactions.FindByID(payment.TransactionID)
+	if err != nil {
+		return err
+	}
+	if transaction.Status == StatusCancelled {
+		return s.refundCancelledPayment(ctx, payment)
+	}
+	return nil
+}
+
+// refundCancelledPayment returns a payment that succeeded after its
+// transaction was cancelled. The idempotency key makes a retried webhook
+// refund it only once.
+func (s *Server) refundCancelledPayment(ctx context.Context, payment *Payment) error {
+	refundID, err := s.payments.Refund(ctx, payment.ChargeID, payment.Amount, fmt.Sprintf("cancel-%d", payment.ID))
+	if err != nil {
+		return fmt.Errorf("refund payment %d of cancelled transaction %d: %w", payment.ID, payment.TransactionID, err)
+	}
+	if _, err := s.repo.Payments.MarkRefunded(payment, refundID); err != nil {
+		return err
+	}
+	log.Printf("payment %d of cancelled transaction %d refunded as %s", payment.ID, payment.TransactionID, refundID)
+	return nil
+}
+
+// voidPendingPayments voids the charges of a cancelled transaction the buyer
+// could still pay. A charge that cannot be voided, e.g. because the buyer
+// paid it a moment ago, stays pending and is refunded by its webhook.
+func (s *Server) voidPendingPayments(ctx context.Context, transactionID uint) {
+	payments, err := s.repo.Payments.ListForTransaction(transactionID)
+	if err != nil {
+		log.Printf("void payments of transaction %d: %v", transactionID, err)
+		return
+	}
+	for i := range payments {
+		payment := &payments[i]
+		if payment.Status != PaymentPending || payment.Provider != s.payments.Name() {
+			continue
+		}
+		if err := s.payments.Void(ctx, payment.ChargeID); err != nil {
+			log.Printf("void payment %d of transaction %d: %v", payment.ID, transactionID, err)
+			continue
+		}
+		if _, err := s.repo.Payments.UpdateStatus(payment, PaymentVoided); err != nil {
+			log.Printf("void payment %d of transaction %d: %v", payment.ID, transactionID, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testMidtransServerKey = "SB-Mid-server-test"
+
+// newTestMidtrans returns a provider talking to handler instead of Midtrans.
+func newTestMidtrans(t *testing.T, handler http.HandlerFunc) *midtransPaymentProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, ok := r.BasicAuth(); !ok || user != testMidtransServerKey {
+			t.Errorf("%s %s: missing server key", r.Method, r.URL.Path)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	p := newMidtransPaymentProvider(MidtransConfig{ServerKey: testMidtransServerKey})
+	p.apiURL = srv.URL
+	p.snapURL = srv.URL
+	p.client = srv.Client()
+	return p
+}
+
+// midtransJSON writes v as the response of the fake Midtrans API.
+func midtransJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestMidtransCreateCharge(t *testing.T) {
+	var orderID string
+	p := newTestMidtrans(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/snap/v1/transactions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			TransactionDetails struct {
+				OrderID     string `json:"order_id"`
+				GrossAmount uint   `json:"gross_amount"`
+			} `json:"transaction_details"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		orderID = body.TransactionDetails.OrderID
+		if !strings.HasPrefix(orderID, "transaction-7-") || body.TransactionDetails.GrossAmount != 2000 {
+			t.Errorf("transaction_details = %+v", body.TransactionDetails)
+		}
+		midtransJSON(w, http.StatusCreated, map[string]string{
+			"token":        "snap-token",
+			"redirect_url": "https://app.sandbox.midtrans.com/snap/v2/vtweb/snap-token",
+		})
+	})
+
+	charge, err := p.CreateCharge(context.Background(), ChargeRequest{Reference: "transaction-7", Amount: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charge.ID != orderID || charge.PaymentURL != "https://app.sandbox.midtrans.com/snap/v2/vtweb/snap-token" {
+		t.Errorf("charge = %+v, want order %s", charge, orderID)
+	}
+}
+
+func TestMidtransCreateChargeError(t *testing.T) {
+	p := newTestMidtrans(t, func(w http.ResponseWriter, r *http.Request) {
+		midtransJSON(w, http.StatusBadRequest, map[string][]string{"error_messages": {"gross_amount is required"}})
+	})
+	if _, err := p.CreateCharge(context.Background(), ChargeRequest{Reference: "transaction-7"}); err == nil {
+		t.Error("CreateCharge succeeded on a 400 response")
+	}
+}
+
+func TestMidtransRefund(t *testing.T) {
+	var refundKeys []string
+	p := newTestMidtrans(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2/order-1/status":
+			refunds := []map[string]interface{}{}
+			for i, key := range refundKeys {
+				refunds = append(refunds, map[string]interface{}{"refund_chargeback_id": 100 + i, "refund_key": key})
+			}
+			midtransJSON(w, http.StatusOK, map[string]interface{}{"status_code": "200", "refunds": refunds})
+		case r.Method == "POST" && r.URL.Path == "/v2/order-1/refund":
+			var body struct {
+				RefundKey string `json:"refund_key"`
+				Amount    uint   `json:"amount"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+			if body.Amount != 500 {
+				t.Errorf("refund amount = %d, want 500", body.Amount)
+			}
+			// Midtrans menolak refund_key yang sama
+			for _, key := range refundKeys {
+				if key == body.RefundKey {
+					midtransJSON(w, http.StatusOK, map[string]string{"status_code": "406", "status_message": "Duplicate refund_key"})
+					return
+				}
+			}
+			refundKeys = append(refundKeys, body.RefundKey)
+			midtransJSON(w, http.StatusOK, map[string]interface{}{"status_code": "200", "refund_chargeback_id": 99 + len(refundKeys)})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	id, err := p.Refund(context.Background(), "order-1", 500, "refund-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "100" {
+		t.Errorf("refund ID = %q, want 100", id)
+	}
+
+	// Refund dengan key yang sama mengembalikan refund pertama
+	again, err := p.Refund(context.Background(), "order-1", 500, "refund-1")
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if again != id || len(refundKeys) != 1 {
+		t.Errorf("retry returned %q after %d refunds, want %q after 1", again, len(refundKeys), id)
+	}
+
+	other, err := p.Refund(context.Background(), "order-1", 500, "refund-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != "101" {
+		t.Errorf("second refund ID = %q, want 101", other)
+	}
+}
+
+func TestMidtransRefundError(t *testing.T) {
+	p := newTestMidtrans(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			midtransJSON(w, http.StatusOK, map[string]string{"status_code": "200"})
+			return
+		}
+		midtransJSON(w, http.StatusOK, map[string]string{"status_code": "412", "status_message": "Merchant cannot modify the status of the transaction"})
+	})
+	if _, err := p.Refund(context.Background(), "order-1", 500, "refund-1"); err == nil {
+		t.Error("Refund succeeded on status_code 412")
+	}
+
+	missing := newTestMidtrans(t, func(w http.ResponseWriter, r *http.Request) {
+		midtransJSON(w, http.StatusNotFound, map[string]string{"status_code": "404", "status_message": "Transaction doesn't exist."})
+	})
+	if _, err := missing.Refund(context.Background(), "order-1", 500, "refund-1"); err == nil {
+		t.Error("Refund succeeded for an unknown order")
+	}
+}
+
+func TestMidtransVoid(t *testing.T) {
+	for code, ok := range map[string]bool{"407": true, "404": true, "412": false} {
+		p := newTestMidtrans(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.URL.Path != "/v2/order-1/expire" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			midtransJSON(w, http.StatusOK, map[string]string{"status_code": code})
+		})
+		if err := p.Void(context.Background(), "order-1"); (err == nil) != ok {
+			t.Errorf("Void with status_code %s: err = %v", code, err)
+		}
+	}
+}
+
+// midtransNotificationBody returns a notification signed with key.
+func midtransNotificationBody(t *testing.T, n midtransNotification, key string) []byte {
+	t.Helper()
+	sum := sha512.Sum512([]byte(n.OrderID + n.StatusCode + n.GrossAmount + key))
+	n.SignatureKey = hex.EncodeToString(sum[:])
+	body, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestMidtransVerifyWebhook(t *testing.T) {
+	p := newMidtransPaymentProvider(MidtransConfig{ServerKey: testMidtransServerKey})
+	n := midtransNotification{
+		TransactionID:     "tx-1",
+		TransactionStatus: "settlement",
+		OrderID:           "transaction-7-abc",
+		StatusCode:        "200",
+		GrossAmount:       "2000.00",
+	}
+
+	event, err := p.VerifyWebhook(http.Header{}, midtransNotificationBody(t, n, testMidtransServerKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WebhookEvent{ID: "tx-1:settlement:", Type: EventChargeSucceeded, ChargeID: "transaction-7-abc", Amount: 2000}
+	if *event != want {
+		t.Errorf("event = %+v, want %+v", *event, want)
+	}
+
+	if _, err := p.VerifyWebhook(http.Header{}, midtransNotificationBody(t, n, "wrong-key")); !errors.Is(err, errInvalidWebhookSignature) {
+		t.Errorf("wrong key: err = %v, want invalid signature", err)
+	}
+	// Nominal yang diubah setelah ditandatangani membuat signature tidak cocok
+	body := midtransNotificationBody(t, n, testMidtransServerKey)
+	tampered := []byte(strings.Replace(string(body), `"2000.00"`, `"1.00"`, 1))
+	if _, err := p.VerifyWebhook(http.Header{}, tampered); !errors.Is(err, errInvalidWebhookSignature) {
+		t.Errorf("tampered amount: err = %v, want invalid signature", err)
+	}
+	if _, err := p.VerifyWebhook(http.Header{}, []byte("not json")); err == nil || errors.Is(err, errInvalidWebhookSignature) {
+		t.Errorf("invalid body: err = %v", err)
+	}
+}
+
+func TestMidtransStatusMapping(t *testing.T) {
+	p := newMidtransPaymentProvider(MidtransConfig{ServerKey: testMidtransServerKey})
+	tests := []struct {
+		status, fraud string
+		want          string
+	}{
+		{"settlement", "", EventChargeSucceeded},
+		{"capture", "accept", EventChargeSucceeded},
+		{"capture", "challenge", "midtrans.capture"},
+		{"pending", "", "midtrans.pending"},
+		{"deny", "", EventChargeFailed},
+		{"cancel", "", EventChargeFailed},
+		{"expire", "", EventChargeFailed},
+		{"failure", "", EventChargeFailed},
+		{"refund", "", "midtrans.refund"},
+	}
+	for _, tt := range tests {
+		n := midtransNotification{
+			TransactionID:     "tx-1",
+			TransactionStatus: tt.status,
+			FraudStatus:       tt.fraud,
+			OrderID:           "transaction-7-abc",
+			StatusCode:        "200",
+			GrossAmount:       "2000.00",
+		}
+		event, err := p.VerifyWebhook(http.Header{}, midtransNotificationBody(t, n, testMidtransServerKey))
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.status, tt.fraud, err)
+		}
+		if event.Type != tt.want {
+			t.Errorf("%s/%s: type = %q, want %q", tt.status, tt.fraud, event.Type, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// orderWithPayment creates a transaction of one item with a pending payment
+// and returns the buyer token, the transaction and the payment.
+func (ts *testServer) orderWithPayment(stock uint) (string, transactionResponse, paymentResponse) {
+	ts.t.Helper()
+	_, adminToken := ts.user("Admin", RoleAdmin)
+	_, sellerToken := ts.user("Seller", RoleSeller)
+	_, buyerToken := ts.user("Buyer", RoleBuyer)
+	product := ts.product(sellerToken, ts.category(adminToken), stock)
+
+	status, transaction := ts.order(buyerToken, ts.address(buyerToken).ID, product.ID, 1)
+	if status != http.StatusCreated {
+		ts.t.Fatalf("create transaction: status %d", status)
+	}
+	var payment paymentResponse
+	ts.expect(http.StatusCreated, "POST", fmt.Sprintf("/api/transactions/%d/payments", transaction.ID), buyerToken, nil, &payment)
+	return buyerToken, transaction, payment
+}
+
+// webhook signs event with the fake provider and posts it to the webhook
+// endpoint. It returns the status code.
+func (ts *testServer) webhook(event WebhookEvent) int {
+	ts.t.Helper()
+	fake := ts.srv.payments.(*fakePaymentProvider)
+	body, header, err := fake.signedWebhook(event)
+	if err != nil {
+		ts.t.Fatalf("sign webhook: %v", err)
+	}
+	req, err := http.NewRequest("POST", ts.http.URL+"/api/payments/webhook", bytes.NewReader(body))
+	if err != nil {
+		ts.t.Fatalf("request: %v", err)
+	}
+	req.Header = header
+	resp, err := ts.http.Client().Do(req)
+	if err != nil {
+		ts.t.Fatalf("webhook: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// payment returns the only payment of a transaction.
+func (ts *testServer) payment(token string, transactionID uint) paymentResponse {
+	ts.t.Helper()
+	var payments []paymentResponse
+	ts.expect(http.StatusOK, "GET", fmt.Sprintf("/api/transactions/%d/payments", transactionID), token, nil, &payments)
+	if len(payments) != 1 {
+		ts.t.Fatalf("transaction %d has %d payments, want 1", transactionID, len(payments))
+	}
+	return payments[0]
+}
+
+func TestCancelVoidsPendingPayment(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		token, transaction, payment := ts.orderWithPayment(5)
+
+		ts.expect(http.StatusOK, "POST", fmt.Sprintf("/api/transactions/%d/cancel", transaction.ID), token, nil, nil)
+		if got := ts.payment(token, transaction.ID); got.Status != PaymentVoided {
+			t.Errorf("payment status after cancel = %q, want %q", got.Status, PaymentVoided)
+		}
+
+		// Provider tidak lagi menerima capture untuk charge yang di-void
+		if status := ts.webhook(WebhookEvent{ID: "evt_1", Type: EventChargeAuthorized, ChargeID: payment.ChargeID, Amount: payment.Amount}); status != http.StatusOK {
+			t.Fatalf("authorized webhook: status %d", status)
+		}
+		if got := ts.payment(token, transaction.ID); got.Status != PaymentVoided {
+			t.Errorf("payment status after authorization = %q, want %q", got.Status, PaymentVoided)
+		}
+	})
+}
+
+func TestPaymentAfterCancelIsRefunded(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		token, transaction, payment := ts.orderWithPayment(5)
+		endpoint := fmt.Sprintf("/api/transactions/%d", transaction.ID)
+
+		// Buyer membayar, lalu transaksi dibatalkan sebelum webhook-nya sampai
+		event := WebhookEvent{ID: "evt_1", Type: EventChargeSucceeded, ChargeID: payment.ChargeID, Amount: payment.Amount}
+		fake := ts.srv.payments.(*fakePaymentProvider)
+		if _, _, err := fake.signedWebhook(event); err != nil {
+			t.Fatal(err)
+		}
+		ts.expect(http.StatusOK, "POST", endpoint+"/cancel", token, nil, nil)
+		if got := ts.payment(token, transaction.ID); got.Status != PaymentPending {
+			t.Errorf("payment status after cancel = %q, want %q because it was captured", got.Status, PaymentPending)
+		}
+
+		// Webhook yang dikirim ulang dengan ID lain tidak me-refund dua kali
+		for i, id := range []string{"evt_1", "evt_2"} {
+			event.ID = id
+			if status := ts.webhook(event); status != http.StatusOK {
+				t.Fatalf("webhook %d: status %d", i, status)
+			}
+		}
+
+		got := ts.payment(token, transaction.ID)
+		if got.Status != PaymentRefunded || got.RefundID == "" {
+			t.Errorf("payment = %+v, want refunded with a refund ID", got)
+		}
+		var current transactionResponse
+		ts.expect(http.StatusOK, "GET", endpoint, token, nil, &current)
+		if current.Status != StatusCancelled {
+			t.Errorf("transaction status = %q, want %q", current.Status, StatusCancelled)
+		}
+
+		fake.mu.Lock()
+		charge := fake.charges[payment.ChargeID]
+		refunded, refunds := charge.refunded, len(charge.refunds)
+		fake.mu.Unlock()
+		if refunded != payment.Amount || refunds != 1 {
+			t.Errorf("provider refunded %d in %d refunds, want %d in 1", refunded, refunds, payment.Amount)
+		}
+	})
+}
+
+func TestPaymentAmountMismatchIsRejected(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		token, transaction, payment := ts.orderWithPayment(5)
+		endpoint := fmt.Sprintf("/api/transactions/%d", transaction.ID)
+
+		for i, eventType := range []string{EventChargeSucceeded, EventChargeAuthorized} {
+			event := WebhookEvent{ID: fmt.Sprintf("evt_%d", i), Type: eventType, ChargeID: payment.ChargeID, Amount: payment.Amount - 1}
+			if status := ts.webhook(event); status != http.StatusUnprocessableEntity {
+				t.Errorf("%s webhook for %d: status %d, want 422", eventType, event.Amount, status)
+			}
+		}
+		var current transactionResponse
+		ts.expect(http.StatusOK, "GET", endpoint, token, nil, &current)
+		if got := ts.payment(token, transaction.ID); got.Status != PaymentPending || current.Status != StatusPendingPayment {
+			t.Errorf("payment %q and transaction %q after mismatched webhooks, want pending", got.Status, current.Status)
+		}
+
+		event := WebhookEvent{ID: "evt_ok", Type: EventChargeSucceeded, ChargeID: payment.ChargeID, Amount: payment.Amount}
+		if status := ts.webhook(event); status != http.StatusOK {
+			t.Fatalf("webhook: status %d", status)
+		}
+		ts.expect(http.StatusOK, "GET", endpoint, token, nil, &current)
+		if current.Status != StatusPaid {
+			t.Errorf("transaction status = %q, want %q", current.Status, StatusPaid)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ownershipPolicy scopes queries to the records owned by the authenticated
+// user, so lookups of someone else's record behave exactly like lookups of a
+// record that does not exist (404).
+type ownershipPolicy struct {
+	// ownerCondition is the WHERE clause selecting the user's records; every
+	// "?" is bound to the user ID.
+	ownerCondition string
+	// adminBypass lets admins access every record.
+	adminBypass bool
+}
+
+// soldTransactionIDs selects the transactions containing a product of the
+// user bound to "?".
+const soldTransactionIDs = "SELECT log_products.transaction_id FROM log_products " +
+	"JOIN products ON products.id = log_products.product_id WHERE products.user_id = ?"
+
+var (
+	addressPolicy = ownershipPolicy{
+		ownerCondition: "addresses.user_id = ?",
+		adminBypass:    true,
+	}
+	productPolicy = ownershipPolicy{
+		ownerCondition: "products.user_id = ?",
+		adminBypass:    true,
+	}
+	// Transactions are visible to the buyer and to the sellers of its products.
+	transactionPolicy = ownershipPolicy{
+		ownerCondition: "transactions.user_id = ? OR transactions.id IN (" + soldTransactionIDs + ")",
+		adminBypass:    true,
+	}
+	// Only a seller of one of the products (or an admin) may confirm a transaction.
+	transactionSellerPolicy = ownershipPolicy{
+		ownerCondition: "transactions.id IN (" + soldTransactionIDs + ")",
+		adminBypass:    true,
+	}
+)
+
+// Scope returns a GORM scope restricting a query to the records of user.
+func (p ownershipPolicy) Scope(user *User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if p.adminBypass && hasRole(user, RoleAdmin) {
+			return db
+		}
+
+		args := make([]interface{}, strings.Count(p.ownerCondition, "?"))
+		for i := range args {
+			args[i] = user.ID
+		}
+		return db.Where(p.ownerCondition, args...)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// ownershipRoute is a request on a record of another user.
+type ownershipRoute struct {
+	method   string
+	endpoint string
+	body     interface{}
+}
+
+// expectNotFound checks that every route answers 404 to token, exactly like
+// a record that does not exist.
+func (ts *testServer) expectNotFound(token string, routes []ownershipRoute) {
+	ts.t.Helper()
+	for _, route := range routes {
+		if got := ts.do(route.method, route.endpoint, token, route.body, nil); got != http.StatusNotFound {
+			ts.t.Errorf("%s %s: status %d, want 404", route.method, route.endpoint, got)
+		}
+	}
+}
+
+func TestAddressOwnership(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		_, sellerToken := ts.user("Seller", RoleSeller)
+		_, aliceToken := ts.user("Alice", RoleBuyer)
+		_, bobToken := ts.user("Bob", RoleBuyer)
+		product := ts.product(sellerToken, ts.category(adminToken), 5)
+		address := ts.address(aliceToken)
+		endpoint := fmt.Sprintf("/api/addresses/%d", address.ID)
+
+		update := addressRequest{Name: "Kantor", Street: "Jl. Asia Afrika 8", City: "Bandung", Province: "Jawa Barat", Zipcode: "40112"}
+		ts.expectNotFound(bobToken, []ownershipRoute{
+			{"GET", endpoint, nil},
+			{"PUT", endpoint, update},
+			{"DELETE", endpoint, nil},
+			// Alamat orang lain juga tidak bisa dipakai untuk pengiriman
+			{"POST", "/api/transactions", createTransactionRequest{
+				AddressID: address.ID,
+				Items:     []transactionItemRequest{{ProductID: product.ID, Quantity: 1}},
+			}},
+		})
+
+		var got addressResponse
+		ts.expect(http.StatusOK, "GET", endpoint, aliceToken, nil, &got)
+		if got.Name != address.Name {
+			t.Errorf("address changed by another buyer: %+v", got)
+		}
+
+		// Admin boleh mengakses alamat semua user
+		ts.expect(http.StatusOK, "GET", endpoint, adminToken, nil, nil)
+		ts.expect(http.StatusOK, "PUT", endpoint, adminToken, update, nil)
+		ts.expect(http.StatusOK, "DELETE", endpoint, adminToken, nil, nil)
+	})
+}
+
+func TestProductOwnership(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		_, sellerToken := ts.user("Seller", RoleSeller)
+		_, otherToken := ts.user("Other", RoleSeller)
+		categoryID := ts.category(adminToken)
+		product := ts.product(sellerToken, categoryID, 5)
+		endpoint := fmt.Sprintf("/api/products/%d", product.ID)
+
+		update := productRequest{CategoryID: categoryID, Name: "Go in Action", Price: 2000, Stock: 1}
+		ts.expectNotFound(otherToken, []ownershipRoute{
+			{"PUT", endpoint, update},
+			{"DELETE", endpoint, nil},
+		})
+
+		// Produk tetap bisa dilihat semua user, dan tidak berubah
+		var got productResponse
+		ts.expect(http.StatusOK, "GET", endpoint, otherToken, nil, &got)
+		if got.Name != product.Name || got.Price != product.Price || got.Stock != product.Stock {
+			t.Errorf("product changed by another seller: %+v", got)
+		}
+
+		ts.expect(http.StatusOK, "PUT", endpoint, sellerToken, update, nil)
+		// Admin boleh mengubah dan menghapus produk semua seller
+		ts.expect(http.StatusOK, "PUT", endpoint, adminToken, update, nil)
+		ts.expect(http.StatusOK, "DELETE", endpoint, adminToken, nil, nil)
+	})
+}
+
+func TestTransactionOwnership(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		_, sellerToken := ts.user("Seller", RoleSeller)
+		_, otherSellerToken := ts.user("Other", RoleSeller)
+		_, aliceToken := ts.user("Alice", RoleBuyer)
+		_, bobToken := ts.user("Bob", RoleBuyer)
+		product := ts.product(sellerToken, ts.category(adminToken), 5)
+
+		status, transaction := ts.order(aliceToken, ts.address(aliceToken).ID, product.ID, 1)
+		if status != http.StatusCreated {
+			t.Fatalf("create transaction: status %d", status)
+		}
+		endpoint := fmt.Sprintf("/api/transactions/%d", transaction.ID)
+
+		ts.expectNotFound(bobToken, []ownershipRoute{
+			{"GET", endpoint, nil},
+			{"GET", endpoint + "/history", nil},
+			{"POST", endpoint + "/cancel", nil},
+			{"POST", endpoint + "/complete", nil},
+			{"GET", endpoint + "/payments", nil},
+			{"POST", endpoint + "/payments", nil},
+			{"GET", endpoint + "/refunds", nil},
+		})
+		// Seller lain tidak menjual produk di transaksi ini
+		ts.expectNotFound(otherSellerToken, []ownershipRoute{
+			{"GET", endpoint, nil},
+			{"POST", endpoint + "/confirm", nil},
+		})
+
+		var list []transactionResponse
+		ts.expect(http.StatusOK, "GET", "/api/transactions", bobToken, nil, &list)
+		if len(list) != 0 {
+			t.Errorf("another buyer lists %d transactions, want 0", len(list))
+		}
+
+		// Buyer, seller produknya dan admin bisa melihat transaksi
+		for _, token := range []string{aliceToken, sellerToken, adminToken} {
+			ts.expect(http.StatusOK, "GET", endpoint, token, nil, nil)
+		}
+		var got transactionResponse
+		ts.expect(http.StatusOK, "GET", endpoint, aliceToken, nil, &got)
+		if got.Status != StatusPendingPayment {
+			t.Errorf("status = %q after requests of other users, want %q", got.Status, StatusPendingPayment)
+		}
+		ts.expect(http.StatusOK, "POST", endpoint+"/cancel", adminToken, nil, nil)
+	})
+}
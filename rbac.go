@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleSeller = "seller"
+	RoleBuyer  = "buyer"
+
+	// roleLegacyUser is the role stored for accounts created before roles
+	// were introduced; it is treated as RoleBuyer.
+	roleLegacyUser = "user"
+)
+
+type Permission string
+
+const (
+	PermManageCategories    Permission = "categories:manage"
+	PermManageProducts      Permission = "products:manage"
+	PermConfirmTransactions Permission = "transactions:confirm"
+	PermManageUsers         Permission = "users:manage"
+)
+
+// rolePermissions lists the permissions granted to each role.
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermManageCategories,
+		PermManageProducts,
+		PermConfirmTransactions,
+		PermManageUsers,
+	},
+	RoleSeller: {
+		PermManageProducts,
+		PermConfirmTransactions,
+	},
+	RoleBuyer: {},
+}
+
+type updateUserRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin seller buyer"`
+}
+
+func normalizeRole(role string) string {
+	if role == "" || role == roleLegacyUser {
+		return RoleBuyer
+	}
+	return role
+}
+
+func hasRole(user *User, roles ...string) bool {
+	role := normalizeRole(user.Role)
+	for _, r := range roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPermission(user *User, perm Permission) bool {
+	for _, p := range rolePermissions[normalizeRole(user.Role)] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole only lets users with one of the given roles through. It must be
+// used behind authMiddleware.
+func RequireRole(roles ...string) mux.MiddlewareFunc {
+	return requireUser(func(user *User) bool {
+		return hasRole(user, roles...)
+	})
+}
+
+// RequirePermission only lets users whose role grants perm through. It must
+// be used behind authMiddleware.
+func RequirePermission(perm Permission) mux.MiddlewareFunc {
+	return requireUser(func(user *User) bool {
+		return hasPermission(user, perm)
+	})
+}
+
+func requireUser(allowed func(*User) bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := userFromContext(r.Context())
+			if !ok {
+				writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+				return
+			}
+			if !allowed(user) {
+				writeError(w, r, newAPIError(http.StatusForbidden, "Forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// updateUserRoleHandler lets an admin promote or demote a user.
+func (s *Server) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	// Get user ID from URL path parameter
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, "invalid user ID"))
+		return
+	}
+
+	var req updateUserRoleRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	// Admin tidak boleh menurunkan role dirinya sendiri agar tidak terkunci
+	if uint(userID) == admin.ID && req.Role != RoleAdmin {
+		writeError(w, r, newAPIError(http.StatusBadRequest, "you cannot demote yourself"))
+		return
+	}
+
+	user, err := s.repo.Users.FindByID(uint(userID))
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "User not found"))
+		return
+	}
+
+	if err := s.repo.Users.UpdateRole(user, req.Role); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Refunds are requested by the buyer for some or all remaining quantities of
+// the lines of a paid transaction and approved or rejected by a seller or an
+// admin. Approved refunds are the refund ledger of the transaction: they are
+// paid back through the payment provider, lower its net price and, once
+// everything is refunded, move the transaction to refunded.
+//
+// Stock is put back automatically when the transaction was not shipped yet;
+// after shipping only when the reviewer confirms the goods were returned.
+//
+// Approving is committed before the money is paid back: the refund is
+// settling until the payment provider confirmed it and only then approved.
+// A settling refund already counts in the ledger, so it cannot be refunded
+// twice; approving it again retries the payout.
+
+// Status of a Refund.
+const (
+	RefundRequested = "requested"
+	RefundSettling  = "settling"
+	RefundApproved  = "approved"
+	RefundRejected  = "rejected"
+)
+
+var (
+	// errRefundReviewed is returned when a refund was approved or rejected by
+	// another request since it was loaded.
+	errRefundReviewed = errors.New("refund already reviewed")
+	// errRefundExceedsTotal is returned when approving a refund would pay back
+	// more than the transaction cost.
+	errRefundExceedsTotal = errors.New("refund exceeds transaction total")
+	// errRefundExceedsQuantity is returned when approving a refund would
+	// refund more of a transaction item than was bought.
+	errRefundExceedsQuantity = errors.New("refund exceeds item quantity")
+)
+
+// refundApproval is applied by RefundRepository.Approve.
+type refundApproval struct {
+	ReviewerID uint
+	Note       string
+	Restock    bool
+	// Status moves the transaction to refunded when the refund completes it;
+	// nil for a partial refund.
+	Status *statusChange
+}
+
+type createRefundRequest struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+	// Items lists the lines to refund; empty refunds everything that was
+	// not refunded yet.
+	Items []refundItemRequest `json:"items" validate:"max=100,dive"`
+}
+
+type refundItemRequest struct {
+	ItemID   uint `json:"item_id" validate:"required"`
+	Quantity uint `json:"quantity" validate:"required,positive"`
+}
+
+type reviewRefundRequest struct {
+	Note string `json:"note" validate:"max=255"`
+	// Restock confirms that shipped goods were returned.
+	Restock bool `json:"restock"`
+}
+
+// stockItems returns the quantities of the refund by product, in the shape
+// used to adjust the stock.
+func (refund *Refund) stockItems() []LogProduct {
+	items := make([]LogProduct, len(refund.Items))
+	for i, item := range refund.Items {
+		items[i] = LogProduct{ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+	return items
+}
+
+// inLedger reports whether refund counts as refunded: it was approved,
+// whether or not the money is back already.
+func (refund *Refund) inLedger() bool {
+	return refund.Status == RefundSettling || refund.Status == RefundApproved
+}
+
+// idempotencyKey identifies the payout of refund at the payment provider, so
+// retrying it does not pay the buyer twice.
+func (refund *Refund) idempotencyKey() string {
+	return fmt.Sprintf("refund-%d", refund.ID)
+}
+
+// approve applies a successful approval to refund.
+func (refund *Refund) approve(approval refundApproval, at time.Time) {
+	refund.Status = RefundSettling
+	refund.Restocked = approval.Restock
+	refund.ReviewerID = approval.ReviewerID
+	refund.ReviewNote = approval.Note
+	refund.ReviewedAt = &at
+	refund.UpdatedAt = at
+}
+
+// settle applies a successful payout to refund.
+func (refund *Refund) settle(providerRefundID string, at time.Time) {
+	refund.Status = RefundApproved
+	refund.ProviderRefundID = providerRefundID
+	refund.UpdatedAt = at
+}
+
+// reject applies a successful rejection to refund.
+func (refund *Refund) reject(reviewerID uint, note string, at time.Time) {
+	refund.Status = RefundRejected
+	refund.ReviewerID = reviewerID
+	refund.ReviewNote = note
+	refund.ReviewedAt = &at
+	refund.UpdatedAt = at
+}
+
+// refundable reports whether a transaction in status can still be refunded.
+func refundable(status string) bool {
+	_, ok := transactionTransitions[status][StatusRefunded]
+	return ok
+}
+
+// refundedQuantities returns the quantity refunded so far by line ID.
+func refundedQuantities(transaction *Transaction) map[uint]uint {
+	quantities := map[uint]uint{}
+	for _, refund := range transaction.Refunds {
+		if !refund.inLedger() {
+			continue
+		}
+		for _, item := range refund.Items {
+			quantities[item.LogProductID] += item.Quantity
+		}
+	}
+	return quantities
+}
+
+// refundItems returns the lines refunded by req, priced with the price of
+// the line at the time of purchase and in the order of the transaction.
+func refundItems(transaction *Transaction, req []refundItemRequest) ([]RefundItem, error) {
+	refunded := refundedQuantities(transaction)
+	lines := map[uint]bool{}
+	for _, line := range transaction.Items {
+		lines[line.ID] = true
+	}
+
+	// Tanpa items berarti semua sisa yang belum direfund
+	requested := map[uint]uint{}
+	for _, item := range req {
+		if !lines[item.ItemID] {
+			return nil, newAPIError(http.StatusNotFound, fmt.Sprintf("Transaction item %d not found", item.ItemID))
+		}
+		requested[item.ItemID] += item.Quantity
+	}
+	if len(req) == 0 {
+		for _, line := range transaction.Items {
+			requested[line.ID] = line.Quantity - refunded[line.ID]
+		}
+	}
+
+	var items []RefundItem
+	for _, line := range transaction.Items {
+		quantity := requested[line.ID]
+		if quantity == 0 {
+			continue
+		}
+		if remaining := line.Quantity - refunded[line.ID]; quantity > remaining {
+			return nil, newAPIError(http.StatusConflict,
+				fmt.Sprintf("Only %d of item %d can be refunded", remaining, line.ID))
+		}
+		items = append(items, RefundItem{
+			LogProductID: line.ID,
+			ProductID:    line.ProductID,
+			Quantity:     quantity,
+			Price:        line.Price,
+		})
+	}
+	if len(items) == 0 {
+		return nil, newAPIError(http.StatusConflict, "Transaction is already fully refunded")
+	}
+	return items, nil
+}
+
+// findRefund returns the refund {id} and its transaction if user may see the
+// transaction.
+func (s *Server) findRefund(user *User, id uint) (*Refund, *Transaction, error) {
+	refund, err := s.repo.Refunds.FindByID(id)
+	if err != nil {
+		return nil, nil, notFoundOr(err, "Refund not found")
+	}
+	// Refund transaksi milik user lain dianggap tidak ditemukan
+	transaction, err := s.repo.Transactions.FindForUser(user, refund.TransactionID)
+	if err != nil {
+		return nil, nil, notFoundOr(err, "Refund not found")
+	}
+	return refund, transaction, nil
+}
+
+// succeededPayment returns the payment that paid transaction, or nil when it
+// was paid outside the payment provider.
+func (s *Server) succeededPayment(transaction *Transaction) (*Payment, error) {
+	payments, err := s.repo.Payments.ListForTransaction(transaction.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range payments {
+		if payments[i].Status == PaymentSucceeded {
+			return &payments[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) createRefundHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "Invalid transaction ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req createRefundRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	transaction, err := s.repo.Transactions.FindForUser(user, id)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Transaction not found"))
+		return
+	}
+	if transaction.UserID != user.ID {
+		writeError(w, r, newAPIError(http.StatusForbidden, "Only the buyer can request a refund"))
+		return
+	}
+	if !refundable(transaction.Status) {
+		writeError(w, r, newAPIError(http.StatusConflict,
+			fmt.Sprintf("Transaction in status %s cannot be refunded", transaction.Status)))
+		return
+	}
+	for _, refund := range transaction.Refunds {
+		if refund.Status == RefundRequested {
+			writeError(w, r, newAPIError(http.StatusConflict, "Transaction already has a pending refund request"))
+			return
+		}
+	}
+
+	items, err := refundItems(transaction, req.Items)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	refund := Refund{
+		TransactionID: transaction.ID,
+		UserID:        user.ID,
+		Reason:        req.Reason,
+		Status:        RefundRequested,
+		Items:         items,
+	}
+	for _, item := range items {
+		refund.Amount += item.Subtotal()
+	}
+	if err := s.repo.Refunds.Create(&refund); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newRefundResponse(&refund))
+}
+
+func (s *Server) getRefundListHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "Invalid transaction ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	transaction, err := s.repo.Transactions.FindForUser(user, id)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Transaction not found"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newRefundListResponse(transaction.Refunds))
+}
+
+// approveRefundHandler pays the refund back and adds it to the ledger of the
+// transaction. The refund that completes the transaction moves it to
+// refunded.
+func (s *Server) approveRefundHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "Invalid refund ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req reviewRefundRequest
+	if r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	refund, transaction, err := s.findRefund(user, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	actors, err := s.transactionActors(user, transaction)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	payment, err := s.succeededPayment(transaction)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	switch refund.Status {
+	case RefundRequested:
+		if err := s.approveRefund(user, actors, refund, transaction, req); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	case RefundSettling:
+		// Approval sebelumnya gagal mengembalikan dana; diulang dengan
+		// idempotency key yang sama
+		if !hasActor(actors, ActorSeller, ActorAdmin) {
+			writeError(w, r, newAPIError(http.StatusForbidden, "You are not allowed to review the refund"))
+			return
+		}
+	default:
+		writeError(w, r, errRefundReviewed)
+		return
+	}
+
+	if err := s.settleRefund(r.Context(), refund, payment); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if transaction.Status == StatusRefunded && payment != nil {
+		if _, err := s.repo.Payments.UpdateStatus(payment, PaymentRefunded); err != nil {
+			log.Printf("request_id=%s failed to mark payment %d refunded: %v", requestIDFromContext(r.Context()), payment.ID, err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, newRefundResponse(refund))
+}
+
+// approveRefund commits the approval of refund as settling, together with
+// the restock and, for the last refund, the move to refunded.
+func (s *Server) approveRefund(user *User, actors []string, refund *Refund, transaction *Transaction, req reviewRefundRequest) error {
+	// Hanya seller atau admin yang boleh merefund, sama seperti transisi ke refunded
+	change, err := planTransition(transaction.Status, StatusRefunded, actors)
+	if err != nil {
+		return err
+	}
+	change.ActorID = user.ID
+	change.Note = fmt.Sprintf("Refund %d", refund.ID)
+
+	approval := refundApproval{
+		ReviewerID: user.ID,
+		Note:       req.Note,
+		// Barang yang belum dikirim selalu kembali ke stok
+		Restock: req.Restock || transaction.Status == StatusPaid || transaction.Status == StatusConfirmed,
+	}
+	if transaction.RefundedAmount()+refund.Amount >= transaction.TotalPrice {
+		approval.Status = &change
+	}
+	return s.repo.Refunds.Approve(refund, transaction, approval)
+}
+
+// settleRefund pays the settling refund back through the payment provider
+// and marks it approved. Transactions paid outside the provider are paid
+// back manually.
+func (s *Server) settleRefund(ctx context.Context, refund *Refund, payment *Payment) error {
+	var providerRefundID string
+	if payment != nil {
+		var err error
+		providerRefundID, err = s.payments.Refund(ctx, payment.ChargeID, refund.Amount, refund.idempotencyKey())
+		if err != nil {
+			log.Printf("refund %d: refund charge %s: %v", refund.ID, payment.ChargeID, err)
+			return newAPIError(http.StatusBadGateway, "Refund was approved but the payment provider failed, approve it again to retry")
+		}
+	}
+	return s.repo.Refunds.Settle(refund, providerRefundID)
+}
+
+func (s *Server) rejectRefundHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "Invalid refund ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req reviewRefundRequest
+	if r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	refund, transaction, err := s.findRefund(user, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	actors, err := s.transactionActors(user, transaction)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !hasActor(actors, ActorSeller, ActorAdmin) {
+		writeError(w, r, newAPIError(http.StatusForbidden, "You are not allowed to review the refund"))
+		return
+	}
+
+	if err := s.repo.Refunds.Reject(refund, user.ID, req.Note); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newRefundResponse(refund))
+}
+
+// hasActor reports whether actors contains one of roles.
+func hasActor(actors []string, roles ...string) bool {
+	for _, actor := range actors {
+		for _, role := range roles {
+			if actor == role {
+				return true
+			}
+		}
+	}
+	return false
+}
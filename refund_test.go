@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// refundFixture is a paid transaction of two lines: two books at 1000 and
+// one laptop at 5000, both with 5 in stock before the order.
+type refundFixture struct {
+	buyerToken  string
+	sellerToken string
+	transaction transactionResponse
+	book        productResponse
+	laptop      productResponse
+	payment     paymentResponse
+}
+
+func (ts *testServer) paidTransaction() refundFixture {
+	ts.t.Helper()
+	_, adminToken := ts.user("Admin", RoleAdmin)
+	_, sellerToken := ts.user("Seller", RoleSeller)
+	_, buyerToken := ts.user("Buyer", RoleBuyer)
+	categoryID := ts.category(adminToken)
+	f := refundFixture{buyerToken: buyerToken, sellerToken: sellerToken}
+	f.book = ts.product(sellerToken, categoryID, 5)
+	ts.expect(http.StatusCreated, "POST", "/api/products", sellerToken, productRequest{
+		CategoryID: categoryID,
+		Name:       "Laptop",
+		Price:      5000,
+		Stock:      5,
+	}, &f.laptop)
+
+	ts.expect(http.StatusCreated, "POST", "/api/transactions", buyerToken, createTransactionRequest{
+		AddressID: ts.address(buyerToken).ID,
+		Items: []transactionItemRequest{
+			{ProductID: f.book.ID, Quantity: 2},
+			{ProductID: f.laptop.ID, Quantity: 1},
+		},
+	}, &f.transaction)
+	ts.expect(http.StatusCreated, "POST", fmt.Sprintf("/api/transactions/%d/payments", f.transaction.ID), buyerToken, nil, &f.payment)
+	event := WebhookEvent{ID: "evt_paid", Type: EventChargeSucceeded, ChargeID: f.payment.ChargeID, Amount: f.payment.Amount}
+	if status := ts.webhook(event); status != http.StatusOK {
+		ts.t.Fatalf("payment webhook: status %d", status)
+	}
+	return f
+}
+
+// line returns the transaction item of product.
+func (f refundFixture) line(product productResponse) uint {
+	for _, item := range f.transaction.Items {
+		if item.ProductID == product.ID {
+			return item.ID
+		}
+	}
+	panic(fmt.Sprintf("product %d is not in the transaction", product.ID))
+}
+
+// requestRefund requests a refund of quantity of product as the buyer.
+func (ts *testServer) requestRefund(f refundFixture, product productResponse, quantity uint) (int, refundResponse) {
+	ts.t.Helper()
+	var refund refundResponse
+	status := ts.do("POST", fmt.Sprintf("/api/transactions/%d/refunds", f.transaction.ID), f.buyerToken, createRefundRequest{
+		Reason: "Rusak",
+		Items:  []refundItemRequest{{ItemID: f.line(product), Quantity: quantity}},
+	}, &refund)
+	return status, refund
+}
+
+// refundedByProvider returns the amount the fake provider paid back for
+// charge and the number of refunds.
+func refundedByProvider(fake *fakePaymentProvider, chargeID string) (uint, int) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	charge := fake.charges[chargeID]
+	return charge.refunded, len(charge.refunds)
+}
+
+func TestPartialRefund(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		f := ts.paidTransaction()
+		endpoint := fmt.Sprintf("/api/transactions/%d", f.transaction.ID)
+
+		status, refund := ts.requestRefund(f, f.book, 1)
+		if status != http.StatusCreated || refund.Amount != 1000 {
+			t.Fatalf("request refund: status %d, amount %d", status, refund.Amount)
+		}
+		var approved refundResponse
+		ts.expect(http.StatusOK, "POST", fmt.Sprintf("/api/refunds/%d/approve", refund.ID), f.sellerToken, nil, &approved)
+		if approved.Status != RefundApproved || approved.ProviderRefundID == "" || !approved.Restocked {
+			t.Errorf("approved refund = %+v", approved)
+		}
+
+		var transaction transactionResponse
+		ts.expect(http.StatusOK, "GET", endpoint, f.buyerToken, nil, &transaction)
+		if transaction.Status != StatusPaid || transaction.RefundedAmount != 1000 || transaction.NetPrice != 6000 {
+			t.Errorf("transaction after partial refund = %+v", transaction)
+		}
+		if got := ts.stock(f.buyerToken, f.book.ID); got != 4 {
+			t.Errorf("book stock = %d, want 4", got)
+		}
+
+		// Sisa transaksi direfund tanpa items
+		var rest refundResponse
+		ts.expect(http.StatusCreated, "POST", endpoint+"/refunds", f.buyerToken, createRefundRequest{Reason: "Batal"}, &rest)
+		if rest.Amount != 6000 {
+			t.Errorf("remaining refund amount = %d, want 6000", rest.Amount)
+		}
+		ts.expect(http.StatusOK, "POST", fmt.Sprintf("/api/refunds/%d/approve", rest.ID), f.sellerToken, nil, nil)
+		ts.expect(http.StatusOK, "GET", endpoint, f.buyerToken, nil, &transaction)
+		if transaction.Status != StatusRefunded || transaction.NetPrice != 0 {
+			t.Errorf("transaction after full refund = %+v", transaction)
+		}
+		if got := ts.payment(f.buyerToken, f.transaction.ID); got.Status != PaymentRefunded {
+			t.Errorf("payment status = %q, want %q", got.Status, PaymentRefunded)
+		}
+		if refunded, _ := refundedByProvider(ts.srv.payments.(*fakePaymentProvider), f.payment.ChargeID); refunded != 7000 {
+			t.Errorf("provider refunded %d, want 7000", refunded)
+		}
+	})
+}
+
+func TestOverRefundIsRejected(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		f := ts.paidTransaction()
+
+		if status, _ := ts.requestRefund(f, f.book, 3); status != http.StatusConflict {
+			t.Errorf("refund of 3 of 2 books: status %d, want 409", status)
+		}
+		status, refund := ts.requestRefund(f, f.book, 2)
+		if status != http.StatusCreated {
+			t.Fatalf("request refund: status %d", status)
+		}
+		ts.expect(http.StatusOK, "POST", fmt.Sprintf("/api/refunds/%d/approve", refund.ID), f.sellerToken, nil, nil)
+		if status, _ := ts.requestRefund(f, f.book, 1); status != http.StatusConflict {
+			t.Errorf("refund of a fully refunded item: status %d, want 409", status)
+		}
+	})
+}
+
+func TestConcurrentRefundApproval(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		f := ts.paidTransaction()
+
+		// Dua permintaan refund untuk kedua buku yang lolos pengecekan
+		// bersamaan; totalnya masih muat dalam harga transaksi
+		status, first := ts.requestRefund(f, f.book, 2)
+		if status != http.StatusCreated {
+			t.Fatalf("request refund: status %d", status)
+		}
+		second := Refund{
+			TransactionID: f.transaction.ID,
+			UserID:        f.transaction.UserID,
+			Reason:        "Rusak",
+			Status:        RefundRequested,
+			Amount:        2000,
+			Items:         []RefundItem{{LogProductID: f.line(f.book), ProductID: f.book.ID, Quantity: 2, Price: 1000}},
+		}
+		if err := ts.srv.repo.Refunds.Create(&second); err != nil {
+			t.Fatal(err)
+		}
+
+		statuses := make([]int, 2)
+		var wg sync.WaitGroup
+		for i, id := range []uint{first.ID, second.ID} {
+			wg.Add(1)
+			go func(i int, id uint) {
+				defer wg.Done()
+				req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/refunds/%d/approve", ts.http.URL, id), nil)
+				if err != nil {
+					return
+				}
+				req.Header.Set("Authorization", "Bearer "+f.sellerToken)
+				resp, err := ts.http.Client().Do(req)
+				if err != nil {
+					return
+				}
+				resp.Body.Close()
+				statuses[i] = resp.StatusCode
+			}(i, id)
+		}
+		wg.Wait()
+
+		approved, conflicts := 0, 0
+		for _, status := range statuses {
+			switch status {
+			case http.StatusOK:
+				approved++
+			case http.StatusConflict:
+				conflicts++
+			}
+		}
+		if approved != 1 || conflicts != 1 {
+			t.Errorf("approvals answered %v, want one 200 and one 409", statuses)
+		}
+		if got := ts.stock(f.buyerToken, f.book.ID); got != 5 {
+			t.Errorf("book stock = %d, want 5", got)
+		}
+		if refunded, refunds := refundedByProvider(ts.srv.payments.(*fakePaymentProvider), f.payment.ChargeID); refunded != 2000 || refunds != 1 {
+			t.Errorf("provider refunded %d in %d refunds, want 2000 in 1", refunded, refunds)
+		}
+	})
+}
+
+// flakyRefundProvider fails the first refunds, like a payment provider that
+// is down for a moment.
+type flakyRefundProvider struct {
+	*fakePaymentProvider
+	failures int
+}
+
+func (p *flakyRefundProvider) Refund(ctx context.Context, chargeID string, amount uint, key string) (string, error) {
+	if p.failures > 0 {
+		p.failures--
+		return "", errors.New("provider unavailable")
+	}
+	return p.fakePaymentProvider.Refund(ctx, chargeID, amount, key)
+}
+
+func TestSettlingRefundRetry(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		f := ts.paidTransaction()
+		fake := ts.srv.payments.(*fakePaymentProvider)
+		ts.srv.payments = &flakyRefundProvider{fakePaymentProvider: fake, failures: 1}
+
+		status, refund := ts.requestRefund(f, f.laptop, 1)
+		if status != http.StatusCreated {
+			t.Fatalf("request refund: status %d", status)
+		}
+		approve := fmt.Sprintf("/api/refunds/%d/approve", refund.ID)
+		ts.expect(http.StatusBadGateway, "POST", approve, f.sellerToken, nil, nil)
+
+		var refunds []refundResponse
+		ts.expect(http.StatusOK, "GET", fmt.Sprintf("/api/transactions/%d/refunds", f.transaction.ID), f.buyerToken, nil, &refunds)
+		if len(refunds) != 1 || refunds[0].Status != RefundSettling {
+			t.Fatalf("refunds after provider failure = %+v, want one settling", refunds)
+		}
+		if got := ts.stock(f.buyerToken, f.laptop.ID); got != 5 {
+			t.Errorf("laptop stock after approval = %d, want 5", got)
+		}
+		// Refund yang masih settling tetap dihitung, jadi tidak bisa diminta lagi
+		if status, _ := ts.requestRefund(f, f.laptop, 1); status != http.StatusConflict {
+			t.Errorf("refund of a settling item: status %d, want 409", status)
+		}
+
+		// Buyer tidak boleh mengulang pembayaran refund
+		ts.expect(http.StatusForbidden, "POST", approve, f.buyerToken, nil, nil)
+		var settled refundResponse
+		ts.expect(http.StatusOK, "POST", approve, f.sellerToken, nil, &settled)
+		if settled.Status != RefundApproved || settled.ProviderRefundID == "" {
+			t.Errorf("refund after retry = %+v", settled)
+		}
+		ts.expect(http.StatusConflict, "POST", approve, f.sellerToken, nil, nil)
+
+		if got := ts.stock(f.buyerToken, f.laptop.ID); got != 5 {
+			t.Errorf("laptop stock after retry = %d, want 5", got)
+		}
+		if refunded, n := refundedByProvider(fake, f.payment.ChargeID); refunded != 5000 || n != 1 {
+			t.Errorf("provider refunded %d in %d refunds, want 5000 in 1", refunded, n)
+		}
+	})
+}
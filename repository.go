@@ -0,0 +1,246 @@
+package main
+
+import "time"
+
+// Repositories hide how the models are persisted from the handlers. Every
+// repository has a GORM implementation (repository_gorm.go) used in
+// production and an in-memory implementation (repository_memory.go) for
+// running the handlers without a database.
+//
+// Lookups that find nothing return gorm.ErrRecordNotFound, so notFoundOr and
+// toAPIError map them to a 404 regardless of the implementation. Methods
+// taking a viewer only see the records the viewer may access, following the
+// ownership policies in policy.go.
+type Repositories struct {
+	Users        UserRepository
+	Addresses    AddressRepository
+	Stores       StoreRepository
+	Categories   CategoryRepository
+	Products     ProductRepository
+	Transactions TransactionRepository
+	Carts        CartRepository
+	Payments     PaymentRepository
+	Refunds      RefundRepository
+
+	Sessions        SessionRepository
+	MFA             MFARepository
+	Verifications   VerificationRepository
+	PasswordResets  PasswordResetRepository
+	LoginAttempts   LoginAttemptRepository
+	IdempotencyKeys IdempotencyKeyRepository
+}
+
+type UserRepository interface {
+	Create(user *User) error
+	FindByID(id uint) (*User, error)
+	FindByEmail(email string) (*User, error)
+	EmailExists(email string) (bool, error)
+	PhoneExists(phone string) (bool, error)
+	// Update saves the profile of user: name, email, phone and their
+	// verification times. Other columns have their own methods.
+	Update(user *User) error
+	UpdateRole(user *User, role string) error
+}
+
+type AddressRepository interface {
+	Create(address *Address) error
+	// FindForUser returns the address if viewer owns it (or is an admin).
+	FindForUser(viewer *User, id uint) (*Address, error)
+	Update(address *Address) error
+	Delete(address *Address) error
+}
+
+type StoreRepository interface {
+	Create(store *Store) error
+	FindByUserID(userID uint) (*Store, error)
+	Update(store *Store) error
+	Delete(store *Store) error
+}
+
+type CategoryRepository interface {
+	Create(category *Category) error
+	List() ([]Category, error)
+	FindByID(id uint) (*Category, error)
+	Update(category *Category) error
+	Delete(id uint) error
+}
+
+type ProductRepository interface {
+	Create(product *Product) error
+	List() ([]Product, error)
+	FindByID(id uint) (*Product, error)
+	// FindByIDs returns the products with the given ids that exist, in no
+	// particular order.
+	FindByIDs(ids []uint) ([]Product, error)
+	// FindForUser returns the product if viewer sells it (or is an admin).
+	FindForUser(viewer *User, id uint) (*Product, error)
+	Update(product *Product) error
+	Delete(product *Product) error
+}
+
+// TransactionRepository loads transactions together with their items and
+// refunds.
+type TransactionRepository interface {
+	// Create inserts transaction and its items and takes their quantities
+	// from the product stock, atomically. It fails with an *OutOfStockError
+	// when a product has not enough stock. The initial status is recorded in
+	// the history as set by the buyer.
+	Create(transaction *Transaction) error
+	// ListForUser returns the transactions viewer bought or sold.
+	ListForUser(viewer *User) ([]Transaction, error)
+	// FindForUser returns the transaction if viewer bought or sold it.
+	FindForUser(viewer *User, id uint) (*Transaction, error)
+	// FindByID returns the transaction regardless of who may see it, for
+	// changes made by the system.
+	FindByID(id uint) (*Transaction, error)
+	// FindForSeller returns the transaction if viewer sold it.
+	FindForSeller(viewer *User, id uint) (*Transaction, error)
+	// Update saves the fields of transaction; its items are never changed.
+	Update(transaction *Transaction) error
+	// ChangeStatus moves transaction from the status it was loaded with to
+	// change.To and records the change in the history, failing with
+	// errTransactionStatusChanged when the stored status differs. With
+	// change.Restock the quantities of the items are added back to the
+	// product stock in the same database transaction.
+	ChangeStatus(transaction *Transaction, change statusChange) error
+	// History returns the status changes of the transaction, oldest first.
+	History(transactionID uint) ([]TransactionStatusHistory, error)
+}
+
+// CartRepository stores the cart of every user, one item per product.
+type CartRepository interface {
+	// List returns the items in the cart of the user, oldest first.
+	List(userID uint) ([]CartItem, error)
+	Find(userID, productID uint) (*CartItem, error)
+	Create(item *CartItem) error
+	Update(item *CartItem) error
+	Delete(item *CartItem) error
+	// Clear empties the cart of the user.
+	Clear(userID uint) error
+}
+
+// PaymentRepository stores the payments of transactions and the webhook
+// events already processed.
+type PaymentRepository interface {
+	Create(payment *Payment) error
+	FindByID(id uint) (*Payment, error)
+	FindByChargeID(provider, chargeID string) (*Payment, error)
+	// ListForTransaction returns the payments of the transaction, oldest
+	// first.
+	ListForTransaction(transactionID uint) ([]Payment, error)
+	// UpdateStatus moves payment from the status it was loaded with to
+	// status. It reports false, without error, when the stored status
+	// differs, so concurrent webhooks apply a change only once.
+	UpdateStatus(payment *Payment, status string) (bool, error)
+	// MarkRefunded moves payment from the status it was loaded with to
+	// refunded and stores the provider refund, like UpdateStatus.
+	MarkRefunded(payment *Payment, refundID string) (bool, error)
+	// EventProcessed reports whether the event was recorded already.
+	EventProcessed(provider, eventID string) (bool, error)
+	RecordEvent(event *PaymentEvent) error
+}
+
+// RefundRepository stores refunds together with their items. The refunds of
+// a transaction are loaded with it in Transaction.Refunds.
+type RefundRepository interface {
+	Create(refund *Refund) error
+	FindByID(id uint) (*Refund, error)
+	// Approve moves refund of transaction to settling, atomically with the
+	// restock of its items and the status change in approval. It fails with
+	// errRefundReviewed when the refund is no longer requested,
+	// errTransactionStatusChanged when the stored status of transaction
+	// differs, errRefundExceedsTotal when the approved refunds would
+	// exceed the total price and errRefundExceedsQuantity when they would
+	// exceed the quantity of an item. The money is paid back after it
+	// committed.
+	Approve(refund *Refund, transaction *Transaction, approval refundApproval) error
+	// Settle marks the settling refund approved once it was paid back. A
+	// refund that was settled already by a concurrent retry is left as is.
+	Settle(refund *Refund, providerRefundID string) error
+	// Reject rejects refund, failing with errRefundReviewed when it is no
+	// longer requested.
+	Reject(refund *Refund, reviewerID uint, note string) error
+}
+
+// SessionRepository stores the refresh tokens of the sessions of users, see
+// session.go.
+type SessionRepository interface {
+	Create(token *RefreshToken) error
+	FindByHash(tokenHash string) (*RefreshToken, error)
+	// Rotate revokes token and stores next, atomically. It fails with
+	// errRefreshTokenReused when token was revoked already, so a token
+	// presented twice at once is only rotated once.
+	Rotate(token *RefreshToken, next *RefreshToken) error
+	// RevokeFamily revokes every token of the family.
+	RevokeFamily(familyID string) error
+	// RevokeAll revokes every token of the user and sets
+	// User.TokensValidAfter, so access tokens issued so far are rejected.
+	RevokeAll(userID uint) error
+}
+
+// MFARepository stores the TOTP secrets and recovery codes of users.
+type MFARepository interface {
+	// SetSecret stores the secret of an enrollment that is not confirmed yet.
+	SetSecret(userID uint, secret string) error
+	// Enable enables TOTP and replaces the recovery codes of the user with
+	// codeHashes, atomically.
+	Enable(userID uint, codeHashes []string) error
+	// Disable disables TOTP and deletes the secret, recovery codes and last
+	// accepted step.
+	Disable(userID uint) error
+	// UseRecoveryCode marks the unused recovery code with codeHash as used.
+	// It reports false when the user has no such code.
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	// AcceptStep records step as the last accepted TOTP step of the user. It
+	// reports false when that step or a later one was already accepted.
+	AcceptStep(userID uint, step int64) (bool, error)
+}
+
+// VerificationRepository stores the codes sent to verify emails and phones.
+type VerificationRepository interface {
+	// Latest returns the code sent last to the user on channel.
+	Latest(userID uint, channel string) (*VerificationCode, error)
+	// Replace invalidates the unused codes of the user on the channel of code
+	// and stores code, atomically.
+	Replace(code *VerificationCode) error
+	// FindPending returns the newest unused code sent to target.
+	FindPending(userID uint, channel, target string) (*VerificationCode, error)
+	// AddAttempt counts a wrong guess of code.
+	AddAttempt(code *VerificationCode) error
+	// Confirm marks code as used and the channel of its user as verified at
+	// at, atomically.
+	Confirm(code *VerificationCode, at time.Time) error
+}
+
+// PasswordResetRepository stores password reset tokens.
+type PasswordResetRepository interface {
+	// Replace invalidates the unused tokens of the user of token and stores
+	// token, atomically.
+	Replace(token *PasswordResetToken) error
+	FindByHash(tokenHash string) (*PasswordResetToken, error)
+	// Consume marks token as used and sets the password of its user,
+	// atomically. It fails with errInvalidResetToken when token was used
+	// already.
+	Consume(token *PasswordResetToken, hashedPassword string) error
+}
+
+// LoginAttemptRepository keeps the audit log of failed logins.
+type LoginAttemptRepository interface {
+	Create(attempt *LoginAttempt) error
+}
+
+// IdempotencyKeyRepository stores the responses to requests sent with an
+// Idempotency-Key, see idempotency.go.
+type IdempotencyKeyRepository interface {
+	Find(userID uint, key string) (*IdempotencyKey, error)
+	// Create fails with a duplicate key error when the user has a record for
+	// the key already, so only one of concurrent requests reserves it.
+	Create(record *IdempotencyKey) error
+	// Complete stores the response saved in record and clears its lock.
+	Complete(record *IdempotencyKey) error
+	// Reclaim deletes record when it is still in progress and its lock
+	// expired before now. It reports false when the request completed or
+	// another request reclaimed the key meanwhile.
+	Reclaim(record *IdempotencyKey, now time.Time) (bool, error)
+	Delete(record *IdempotencyKey) error
+}
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// newGormRepositories returns repositories backed by db.
+func newGormRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:        gormUserRepository{db},
+		Addresses:    gormAddressRepository{db},
+		Stores:       gormStoreRepository{db},
+		Categories:   gormCategoryRepository{db},
+		Products:     gormProductRepository{db},
+		Transactions: gormTransactionRepository{db},
+		Carts:        gormCartRepository{db},
+		Payments:     gormPaymentRepository{db},
+		Refunds:      gormRefundRepository{db},
+
+		Sessions:        gormSessionRepository{db},
+		MFA:             gormMFARepository{db},
+		Verifications:   gormVerificationRepository{db},
+		PasswordResets:  gormPasswordResetRepository{db},
+		LoginAttempts:   gormLoginAttemptRepository{db},
+		IdempotencyKeys: gormIdempotencyKeyRepository{db},
+	}
+}
+
+type gormUserRepository struct{ db *gorm.DB }
+
+func (r gormUserRepository) Create(user *User) error {
+	return r.db.Create(user).Error
+}
+
+func (r gormUserRepository) FindByID(id uint) (*User, error) {
+	var user User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r gormUserRepository) FindByEmail(email string) (*User, error) {
+	var user User
+	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r gormUserRepository) EmailExists(email string) (bool, error) {
+	var count int
+	err := r.db.Model(&User{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+func (r gormUserRepository) PhoneExists(phone string) (bool, error) {
+	var count int
+	err := r.db.Model(&User{}).Where("phone = ?", phone).Count(&count).Error
+	return count > 0, err
+}
+
+func (r gormUserRepository) Update(user *User) error {
+	// Hanya kolom profil yang ditulis, jadi salinan user yang sudah lama tidak
+	// menimpa password, role atau TOTP yang diubah di request lain
+	return r.db.Model(user).Updates(map[string]interface{}{
+		"name":              user.Name,
+		"email":             user.Email,
+		"phone":             user.Phone,
+		"email_verified_at": user.EmailVerifiedAt,
+		"phone_verified_at": user.PhoneVerifiedAt,
+	}).Error
+}
+
+func (r gormUserRepository) UpdateRole(user *User, role string) error {
+	return r.db.Model(user).Update("role", role).Error
+}
+
+type gormAddressRepository struct{ db *gorm.DB }
+
+func (r gormAddressRepository) Create(address *Address) error {
+	return r.db.Create(address).Error
+}
+
+func (r gormAddressRepository) FindForUser(viewer *User, id uint) (*Address, error) {
+	var address Address
+	if err := r.db.Scopes(addressPolicy.Scope(viewer)).First(&address, id).Error; err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+func (r gormAddressRepository) Update(address *Address) error {
+	return r.db.Save(address).Error
+}
+
+func (r gormAddressRepository) Delete(address *Address) error {
+	return r.db.Delete(address).Error
+}
+
+type gormStoreRepository struct{ db *gorm.DB }
+
+func (r gormStoreRepository) Create(store *Store) error {
+	return r.db.Create(store).Error
+}
+
+func (r gormStoreRepository) FindByUserID(userID uint) (*Store, error) {
+	var store Store
+	if err := r.db.Where("user_id = ?", userID).First(&store).Error; err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+func (r gormStoreRepository) Update(store *Store) error {
+	return r.db.Save(store).Error
+}
+
+func (r gormStoreRepository) Delete(store *Store) error {
+	return r.db.Delete(store).Error
+}
+
+type gormCategoryRepository struct{ db *gorm.DB }
+
+func (r gormCategoryRepository) Create(category *Category) error {
+	return r.db.Create(category).Error
+}
+
+func (r gormCategoryRepository) List() ([]Category, error) {
+	var categories []Category
+	if err := r.db.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r gormCategoryRepository) FindByID(id uint) (*Category, error) {
+	var category Category
+	if err := r.db.First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r gormCategoryRepository) Update(category *Category) error {
+	return r.db.Save(category).Error
+}
+
+func (r gormCategoryRepository) Delete(id uint) error {
+	return r.db.Delete(&Category{ID: id}).Error
+}
+
+type gormProductRepository struct{ db *gorm.DB }
+
+func (r gormProductRepository) Create(product *Product) error {
+	return r.db.Create(product).Error
+}
+
+func (r gormProductRepository) List() ([]Product, error) {
+	var products []Product
+	if err := r.db.Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r gormProductRepository) FindByID(id uint) (*Product, error) {
+	var product Product
+	if err := r.db.First(&product, id).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r gormProductRepository) FindByIDs(ids []uint) ([]Product, error) {
+	var products []Product
+	if len(ids) == 0 {
+		return products, nil
+	}
+	if err := r.db.Where("id IN (?)", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r gormProductRepository) FindForUser(viewer *User, id uint) (*Product, error) {
+	var product Product
+	if err := r.db.Scopes(productPolicy.Scope(viewer)).First(&product, id).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r gormProductRepository) Update(product *Product) error {
+	return r.db.Save(product).Error
+}
+
+func (r gormProductRepository) Delete(product *Product) error {
+	return r.db.Delete(product).Error
+}
+
+type gormTransactionRepository struct{ db *gorm.DB }
+
+func (r gormTransactionRepository) Create(transaction *Transaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Stok dikurangi dengan UPDATE bersyarat, jadi dua checkout yang
+		// bersamaan tidak bisa menjual lebih dari stok yang ada
+		var outOfStock []outOfStockItem
+		for _, item := range sortedByProduct(transaction.Items) {
+			res := tx.Model(&Product{}).Where("id = ? AND stock >= ?", item.ProductID, item.Quantity).
+				UpdateColumn("stock", gorm.Expr("stock - ?", item.Quantity))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				var product Product
+				if err := tx.Select("stock").First(&product, item.ProductID).Error; err != nil {
+					return err
+				}
+				outOfStock = append(outOfStock, outOfStockItem{
+					ProductID: item.ProductID,
+					Quantity:  item.Quantity,
+					Stock:     product.Stock,
+				})
+			}
+		}
+		if len(outOfStock) > 0 {
+			return &OutOfStockError{Items: outOfStock}
+		}
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		return tx.Create(initialHistory(transaction)).Error
+	})
+}
+
+func (r gormTransactionRepository) ListForUser(viewer *User) ([]Transaction, error) {
+	var transactions []Transaction
+	if err := r.db.Scopes(transactionPolicy.Scope(viewer), transactionDetails).Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (r gormTransactionRepository) FindForUser(viewer *User, id uint) (*Transaction, error) {
+	return r.find(transactionPolicy, viewer, id)
+}
+
+func (r gormTransactionRepository) FindByID(id uint) (*Transaction, error) {
+	var transaction Transaction
+	if err := r.db.Scopes(transactionDetails).First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (r gormTransactionRepository) FindForSeller(viewer *User, id uint) (*Transaction, error) {
+	return r.find(transactionSellerPolicy, viewer, id)
+}
+
+func (r gormTransactionRepository) find(policy ownershipPolicy, viewer *User, id uint) (*Transaction, error) {
+	var transaction Transaction
+	if err := r.db.Scopes(policy.Scope(viewer), transactionDetails).First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// transactionDetails preloads the items and refunds of transactions.
+func transactionDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items", orderedItems).Preload("Refunds", orderedRefunds).Preload("Refunds.Items", orderedRefundItems)
+}
+
+// orderedItems preloads the items of transactions in the order they were added.
+func orderedItems(db *gorm.DB) *gorm.DB {
+	return db.Order("log_products.id")
+}
+
+func orderedRefunds(db *gorm.DB) *gorm.DB {
+	return db.Order("refunds.id")
+}
+
+func orderedRefundItems(db *gorm.DB) *gorm.DB {
+	return db.Order("refund_items.id")
+}
+
+func (r gormTransactionRepository) Update(transaction *Transaction) error {
+	return r.db.Set("gorm:save_associations", false).Save(transaction).Error
+}
+
+func (r gormTransactionRepository) ChangeStatus(transaction *Transaction, change statusChange) error {
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Transaction{}).Where("id = ? AND status = ?", transaction.ID, transaction.Status).
+			Updates(map[string]interface{}{"status": change.To, "updated_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errTransactionStatusChanged
+		}
+		if err := tx.Create(newHistory(transaction, change, now)).Error; err != nil {
+			return err
+		}
+		if !change.Restock {
+			return nil
+		}
+		for _, item := range sortedByProduct(transaction.Items) {
+			err := tx.Model(&Product{}).Where("id = ?", item.ProductID).
+				UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	transaction.Status = change.To
+	transaction.UpdatedAt = now
+	return nil
+}
+
+func (r gormTransactionRepository) History(transactionID uint) ([]TransactionStatusHistory, error) {
+	var history []TransactionStatusHistory
+	if err := r.db.Where("transaction_id = ?", transactionID).Order("id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+type gormCartRepository struct{ db *gorm.DB }
+
+func (r gormCartRepository) List(userID uint) ([]CartItem, error) {
+	var items []CartItem
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r gormCartRepository) Find(userID, productID uint) (*CartItem, error) {
+	var item CartItem
+	if err := r.db.Where("user_id = ? AND product_id = ?", userID, productID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r gormCartRepository) Create(item *CartItem) error {
+	return r.db.Create(item).Error
+}
+
+func (r gormCartRepository) Update(item *CartItem) error {
+	return r.db.Save(item).Error
+}
+
+func (r gormCartRepository) Delete(item *CartItem) error {
+	return r.db.Delete(item).Error
+}
+
+func (r gormCartRepository) Clear(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&CartItem{}).Error
+}
+
+type gormPaymentRepository struct{ db *gorm.DB }
+
+func (r gormPaymentRepository) Create(payment *Payment) error {
+	return r.db.Create(payment).Error
+}
+
+func (r gormPaymentRepository) FindByID(id uint) (*Payment, error) {
+	var payment Payment
+	if err := r.db.First(&payment, id).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r gormPaymentRepository) FindByChargeID(provider, chargeID string) (*Payment, error) {
+	var payment Payment
+	if err := r.db.Where("provider = ? AND charge_id = ?", provider, chargeID).First(&payment).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r gormPaymentRepository) ListForTransaction(transactionID uint) ([]Payment, error) {
+	var payments []Payment
+	if err := r.db.Where("transaction_id = ?", transactionID).Order("id").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (r gormPaymentRepository) UpdateStatus(payment *Payment, status string) (bool, error) {
+	now := time.Now()
+	res := r.db.Model(&Payment{}).Where("id = ? AND status = ?", payment.ID, payment.Status).
+		Updates(map[string]interface{}{"status": status, "updated_at": now})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	payment.Status = status
+	payment.UpdatedAt = now
+	return true, nil
+}
+
+func (r gormPaymentRepository) MarkRefunded(payment *Payment, refundID string) (bool, error) {
+	now := time.Now()
+	res := r.db.Model(&Payment{}).Where("id = ? AND status = ?", payment.ID, payment.Status).
+		Updates(map[string]interface{}{"status": PaymentRefunded, "refund_id": refundID, "updated_at": now})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	payment.Status = PaymentRefunded
+	payment.RefundID = refundID
+	payment.UpdatedAt = now
+	return true, nil
+}
+
+func (r gormPaymentRepository) EventProcessed(provider, eventID string) (bool, error) {
+	var count int
+	err := r.db.Model(&PaymentEvent{}).Where("provider = ? AND event_id = ?", provider, eventID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r gormPaymentRepository) RecordEvent(event *PaymentEvent) error {
+	return r.db.Create(event).Error
+}
+
+type gormRefundRepository struct{ db *gorm.DB }
+
+func (r gormRefundRepository) Create(refund *Refund) error {
+	return r.db.Create(refund).Error
+}
+
+func (r gormRefundRepository) FindByID(id uint) (*Refund, error) {
+	var refund Refund
+	if err := r.db.Preload("Items", orderedRefundItems).First(&refund, id).Error; err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r gormRefundRepository) Approve(refund *Refund, transaction *Transaction, approval refundApproval) error {
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Mengunci baris transaksi dulu, jadi approval untuk transaksi yang
+		// sama berjalan bergantian dan total refund bisa dicek dengan aman
+		res := tx.Model(&Transaction{}).Where("id = ? AND status = ?", transaction.ID, transaction.Status).
+			UpdateColumn("updated_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errTransactionStatusChanged
+		}
+
+		res = tx.Model(&Refund{}).Where("id = ? AND status = ?", refund.ID, RefundRequested).
+			Updates(map[string]interface{}{
+				"status":      RefundSettling,
+				"restocked":   approval.Restock,
+				"reviewer_id": approval.ReviewerID,
+				"review_note": approval.Note,
+				"reviewed_at": now,
+				"updated_at":  now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefundReviewed
+		}
+
+		var refunded uint
+		row := tx.Model(&Refund{}).Where("transaction_id = ? AND status IN (?)", transaction.ID, []string{RefundSettling, RefundApproved}).
+			Select("COALESCE(SUM(amount), 0)").Row()
+		if err := row.Scan(&refunded); err != nil {
+			return err
+		}
+		if refunded > transaction.TotalPrice {
+			return errRefundExceedsTotal
+		}
+
+		// Jumlah per item juga dicek ulang: dua refund untuk item yang sama
+		// bisa dibuat bersamaan dan keduanya masih muat dalam total
+		var exceeded []struct{ LogProductID uint }
+		err := tx.Table("refund_items").Select("refund_items.log_product_id").
+			Joins("JOIN refunds ON refunds.id = refund_items.refund_id").
+			Joins("JOIN log_products ON log_products.id = refund_items.log_product_id").
+			Where("refunds.transaction_id = ? AND refunds.status IN (?)", transaction.ID, []string{RefundSettling, RefundApproved}).
+			Group("refund_items.log_product_id, log_products.quantity").
+			Having("SUM(refund_items.quantity) > log_products.quantity").
+			Scan(&exceeded).Error
+		if err != nil {
+			return err
+		}
+		if len(exceeded) > 0 {
+			return errRefundExceedsQuantity
+		}
+
+		if approval.Restock {
+			for _, item := range sortedByProduct(refund.stockItems()) {
+				err := tx.Model(&Product{}).Where("id = ?", item.ProductID).
+					UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if approval.Status != nil {
+			err := tx.Model(&Transaction{}).Where("id = ?", transaction.ID).
+				UpdateColumn("status", approval.Status.To).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(newHistory(transaction, *approval.Status, now)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	refund.approve(approval, now)
+	if approval.Status != nil {
+		transaction.Status = approval.Status.To
+	}
+	transaction.UpdatedAt = now
+	return nil
+}
+
+func (r gormRefundRepository) Settle(refund *Refund, providerRefundID string) error {
+	now := time.Now()
+	err := r.db.Model(&Refund{}).Where("id = ? AND status = ?", refund.ID, RefundSettling).
+		Updates(map[string]interface{}{
+			"status":             RefundApproved,
+			"provider_refund_id": providerRefundID,
+			"updated_at":         now,
+		}).Error
+	if err != nil {
+		return err
+	}
+	refund.settle(providerRefundID, now)
+	return nil
+}
+
+func (r gormRefundRepository) Reject(refund *Refund, reviewerID uint, note string) error {
+	now := time.Now()
+	res := r.db.Model(&Refund{}).Where("id = ? AND status = ?", refund.ID, RefundRequested).
+		Updates(map[string]interface{}{
+			"status":      RefundRejected,
+			"reviewer_id": reviewerID,
+			"review_note": note,
+			"reviewed_at": now,
+			"updated_at":  now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errRefundReviewed
+	}
+	refund.reject(reviewerID, note, now)
+	return nil
+}
+
+type gormSessionRepository struct{ db *gorm.DB }
+
+func (r gormSessionRepository) Create(token *RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r gormSessionRepository) FindByHash(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r gormSessionRepository) Rotate(token *RefreshToken, next *RefreshToken) error {
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Revoke hanya jika belum di-revoke oleh request lain secara bersamaan
+		res := tx.Model(&RefreshToken{}).Where("id = ? AND revoked_at IS NULL", token.ID).
+			Update("revoked_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return err
+	}
+	token.RevokedAt = &now
+	return nil
+}
+
+func (r gormSessionRepository) RevokeFamily(familyID string) error {
+	return r.db.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r gormSessionRepository) RevokeAll(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Database menyimpan waktu paling teliti sampai mikrodetik
+		now := time.Now().Truncate(time.Microsecond)
+		if err := tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", userID).Update("tokens_valid_after", now).Error
+	})
+}
+
+type gormMFARepository struct{ db *gorm.DB }
+
+func (r gormMFARepository) SetSecret(userID uint, secret string) error {
+	return r.db.Model(&User{}).Where("id = ?", userID).Update("totp_secret", secret).Error
+}
+
+func (r gormMFARepository) Enable(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range codeHashes {
+			if err := tx.Create(&RecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&User{}).Where("id = ?", userID).Update("totp_enabled", true).Error
+	})
+}
+
+func (r gormMFARepository) Disable(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&TOTPStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": ""}).Error
+	})
+}
+
+func (r gormMFARepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	res := r.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (r gormMFARepository) AcceptStep(userID uint, step int64) (bool, error) {
+	// Update bersyarat agar dua request dengan kode yang sama tidak
+	// sama-sama diterima
+	res := r.db.Model(&TOTPStep{}).Where("user_id = ? AND step < ?", userID, step).
+		Updates(map[string]interface{}{"step": step, "updated_at": time.Now()})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	var count int
+	if err := r.db.Model(&TOTPStep{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	// Primary key menolak insert kedua bila dua request pertama bersamaan
+	if err := r.db.Create(&TOTPStep{UserID: userID, Step: step}).Error; err != nil {
+		if isDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+type gormVerificationRepository struct{ db *gorm.DB }
+
+func (r gormVerificationRepository) Latest(userID uint, channel string) (*VerificationCode, error) {
+	var code VerificationCode
+	err := r.db.Where("user_id = ? AND channel = ?", userID, channel).Order("created_at desc").First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r gormVerificationRepository) Replace(code *VerificationCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&VerificationCode{}).
+			Where("user_id = ? AND channel = ? AND used_at IS NULL", code.UserID, code.Channel).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+}
+
+func (r gormVerificationRepository) FindPending(userID uint, channel, target string) (*VerificationCode, error) {
+	var code VerificationCode
+	err := r.db.Where("user_id = ? AND channel = ? AND target = ? AND used_at IS NULL", userID, channel, target).
+		Order("created_at desc").First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r gormVerificationRepository) AddAttempt(code *VerificationCode) error {
+	if err := r.db.Model(code).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		return err
+	}
+	code.Attempts++
+	return nil
+}
+
+func (r gormVerificationRepository) Confirm(code *VerificationCode, at time.Time) error {
+	column := "email_verified_at"
+	if code.Channel == ChannelPhone {
+		column = "phone_verified_at"
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(code).Update("used_at", at).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", code.UserID).Update(column, at).Error
+	})
+}
+
+type gormPasswordResetRepository struct{ db *gorm.DB }
+
+func (r gormPasswordResetRepository) Replace(token *PasswordResetToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (r gormPasswordResetRepository) FindByHash(tokenHash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r gormPasswordResetRepository) Consume(token *PasswordResetToken, hashedPassword string) error {
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Token hanya boleh dipakai satu kali
+		res := tx.Model(&PasswordResetToken{}).Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+		return tx.Model(&User{}).Where("id = ?", token.UserID).Update("password", hashedPassword).Error
+	})
+	if err != nil {
+		return err
+	}
+	token.UsedAt = &now
+	return nil
+}
+
+type gormLoginAttemptRepository struct{ db *gorm.DB }
+
+func (r gormLoginAttemptRepository) Create(attempt *LoginAttempt) error {
+	return r.db.Create(attempt).Error
+}
+
+type gormIdempotencyKeyRepository struct{ db *gorm.DB }
+
+func (r gormIdempotencyKeyRepository) Find(userID uint, key string) (*IdempotencyKey, error) {
+	var record IdempotencyKey
+	if err := r.db.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r gormIdempotencyKeyRepository) Create(record *IdempotencyKey) error {
+	return r.db.Create(record).Error
+}
+
+func (r gormIdempotencyKeyRepository) Complete(record *IdempotencyKey) error {
+	record.UpdatedAt = time.Now()
+	record.LockedUntil = nil
+	return r.db.Model(record).Updates(map[string]interface{}{
+		"status_code":   record.StatusCode,
+		"locked_until":  nil,
+		"content_type":  record.ContentType,
+		"response_body": record.ResponseBody,
+		"updated_at":    record.UpdatedAt,
+	}).Error
+}
+
+func (r gormIdempotencyKeyRepository) Reclaim(record *IdempotencyKey, now time.Time) (bool, error) {
+	// Baris tanpa locked_until berasal dari sebelum kolom ini ada
+	res := r.db.Where("id = ? AND status_code = 0 AND (locked_until IS NULL OR locked_until < ?)", record.ID, now).
+		Delete(&IdempotencyKey{})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (r gormIdempotencyKeyRepository) Delete(record *IdempotencyKey) error {
+	return r.db.Delete(record).Error
+}
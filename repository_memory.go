@@ -0,0 +1,1310 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryStore keeps every model in maps guarded by a single mutex. It backs
+// the in-memory repositories, which share it so ownership checks can look at
+// related records (e.g. the product of a transaction).
+type memoryStore struct {
+	mu           sync.Mutex
+	nextID       uint
+	users        map[uint]User
+	addresses    map[uint]Address
+	stores       map[uint]Store
+	categories   map[uint]Category
+	products     map[uint]Product
+	transactions map[uint]Transaction
+	cartItems    map[uint]CartItem
+	history      map[uint]TransactionStatusHistory
+	payments     map[uint]Payment
+	events       map[uint]PaymentEvent
+	refunds      map[uint]Refund
+
+	refreshTokens     map[uint]RefreshToken
+	recoveryCodes     map[uint]RecoveryCode
+	totpSteps         map[uint]TOTPStep
+	verificationCodes map[uint]VerificationCode
+	passwordResets    map[uint]PasswordResetToken
+	loginAttempts     map[uint]LoginAttempt
+	idempotencyKeys   map[uint]IdempotencyKey
+}
+
+// newMemoryRepositories returns repositories that keep everything in memory.
+// Data is lost when the process exits.
+func newMemoryRepositories() Repositories {
+	m := &memoryStore{
+		users:        map[uint]User{},
+		addresses:    map[uint]Address{},
+		stores:       map[uint]Store{},
+		categories:   map[uint]Category{},
+		products:     map[uint]Product{},
+		transactions: map[uint]Transaction{},
+		cartItems:    map[uint]CartItem{},
+		history:      map[uint]TransactionStatusHistory{},
+		payments:     map[uint]Payment{},
+		events:       map[uint]PaymentEvent{},
+		refunds:      map[uint]Refund{},
+
+		refreshTokens:     map[uint]RefreshToken{},
+		recoveryCodes:     map[uint]RecoveryCode{},
+		totpSteps:         map[uint]TOTPStep{},
+		verificationCodes: map[uint]VerificationCode{},
+		passwordResets:    map[uint]PasswordResetToken{},
+		loginAttempts:     map[uint]LoginAttempt{},
+		idempotencyKeys:   map[uint]IdempotencyKey{},
+	}
+	return Repositories{
+		Users:        memoryUserRepository{m},
+		Addresses:    memoryAddressRepository{m},
+		Stores:       memoryStoreRepository{m},
+		Categories:   memoryCategoryRepository{m},
+		Products:     memoryProductRepository{m},
+		Transactions: memoryTransactionRepository{m},
+		Carts:        memoryCartRepository{m},
+		Payments:     memoryPaymentRepository{m},
+		Refunds:      memoryRefundRepository{m},
+
+		Sessions:        memorySessionRepository{m},
+		MFA:             memoryMFARepository{m},
+		Verifications:   memoryVerificationRepository{m},
+		PasswordResets:  memoryPasswordResetRepository{m},
+		LoginAttempts:   memoryLoginAttemptRepository{m},
+		IdempotencyKeys: memoryIdempotencyKeyRepository{m},
+	}
+}
+
+func (m *memoryStore) newID() uint {
+	m.nextID++
+	return m.nextID
+}
+
+// canAccess mirrors ownershipPolicy.Scope: admins see everything, other users
+// only the records they own.
+func canAccess(viewer *User, ownerIDs ...uint) bool {
+	if hasRole(viewer, RoleAdmin) {
+		return true
+	}
+	for _, id := range ownerIDs {
+		if id == viewer.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedIDs sorts ids in ascending order so listings are stable.
+func sortedIDs(ids []uint) []uint {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+type memoryUserRepository struct{ m *memoryStore }
+
+// uniqueUser mirrors the unique constraints on users.email and users.phone.
+func (m *memoryStore) uniqueUser(user *User) error {
+	for _, stored := range m.users {
+		if stored.ID != user.ID && (stored.Email == user.Email || stored.Phone == user.Phone) {
+			return errDuplicateKey
+		}
+	}
+	return nil
+}
+
+func (r memoryUserRepository) Create(user *User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.uniqueUser(user); err != nil {
+		return err
+	}
+	user.ID = r.m.newID()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	r.m.users[user.ID] = *user
+	return nil
+}
+
+func (r memoryUserRepository) FindByID(id uint) (*User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	user, ok := r.m.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (r memoryUserRepository) FindByEmail(email string) (*User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, user := range r.m.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r memoryUserRepository) EmailExists(email string) (bool, error) {
+	_, err := r.FindByEmail(email)
+	return err == nil, nil
+}
+
+func (r memoryUserRepository) PhoneExists(phone string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, user := range r.m.users {
+		if user.Phone == phone {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r memoryUserRepository) Update(user *User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.users[user.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if err := r.m.uniqueUser(user); err != nil {
+		return err
+	}
+	stored.Name = user.Name
+	stored.Email = user.Email
+	stored.Phone = user.Phone
+	stored.EmailVerifiedAt = user.EmailVerifiedAt
+	stored.PhoneVerifiedAt = user.PhoneVerifiedAt
+	stored.UpdatedAt = time.Now()
+	r.m.users[user.ID] = stored
+	user.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r memoryUserRepository) UpdateRole(user *User, role string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.users[user.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	stored.Role = role
+	stored.UpdatedAt = time.Now()
+	r.m.users[user.ID] = stored
+	*user = stored
+	return nil
+}
+
+type memoryAddressRepository struct{ m *memoryStore }
+
+func (r memoryAddressRepository) Create(address *Address) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	address.ID = r.m.newID()
+	address.CreatedAt = time.Now()
+	address.UpdatedAt = address.CreatedAt
+	r.m.addresses[address.ID] = *address
+	return nil
+}
+
+func (r memoryAddressRepository) FindForUser(viewer *User, id uint) (*Address, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	address, ok := r.m.addresses[id]
+	if !ok || !canAccess(viewer, address.UserID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &address, nil
+}
+
+func (r memoryAddressRepository) Update(address *Address) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.addresses[address.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	address.UpdatedAt = time.Now()
+	r.m.addresses[address.ID] = *address
+	return nil
+}
+
+func (r memoryAddressRepository) Delete(address *Address) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.addresses, address.ID)
+	return nil
+}
+
+type memoryStoreRepository struct{ m *memoryStore }
+
+func (r memoryStoreRepository) Create(store *Store) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	store.ID = r.m.newID()
+	store.CreatedAt = time.Now()
+	store.UpdatedAt = store.CreatedAt
+	r.m.stores[store.ID] = *store
+	return nil
+}
+
+func (r memoryStoreRepository) FindByUserID(userID uint) (*Store, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, store := range r.m.stores {
+		if store.UserID == userID {
+			return &store, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r memoryStoreRepository) Update(store *Store) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.stores[store.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	store.UpdatedAt = time.Now()
+	r.m.stores[store.ID] = *store
+	return nil
+}
+
+func (r memoryStoreRepository) Delete(store *Store) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.stores, store.ID)
+	return nil
+}
+
+type memoryCategoryRepository struct{ m *memoryStore }
+
+func (r memoryCategoryRepository) Create(category *Category) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	category.ID = r.m.newID()
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = category.CreatedAt
+	r.m.categories[category.ID] = *category
+	return nil
+}
+
+func (r memoryCategoryRepository) List() ([]Category, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ids := make([]uint, 0, len(r.m.categories))
+	for id := range r.m.categories {
+		ids = append(ids, id)
+	}
+	categories := make([]Category, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		categories = append(categories, r.m.categories[id])
+	}
+	return categories, nil
+}
+
+func (r memoryCategoryRepository) FindByID(id uint) (*Category, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	category, ok := r.m.categories[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &category, nil
+}
+
+func (r memoryCategoryRepository) Update(category *Category) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.categories[category.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	category.UpdatedAt = time.Now()
+	r.m.categories[category.ID] = *category
+	return nil
+}
+
+func (r memoryCategoryRepository) Delete(id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	// Sama seperti foreign key products.category_id di database
+	for _, product := range r.m.products {
+		if product.CategoryID == id {
+			return errForeignKey
+		}
+	}
+	delete(r.m.categories, id)
+	return nil
+}
+
+type memoryProductRepository struct{ m *memoryStore }
+
+func (r memoryProductRepository) Create(product *Product) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product.ID = r.m.newID()
+	product.CreatedAt = time.Now()
+	product.UpdatedAt = product.CreatedAt
+	r.m.products[product.ID] = *product
+	return nil
+}
+
+func (r memoryProductRepository) List() ([]Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ids := make([]uint, 0, len(r.m.products))
+	for id := range r.m.products {
+		ids = append(ids, id)
+	}
+	products := make([]Product, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		products = append(products, r.m.products[id])
+	}
+	return products, nil
+}
+
+func (r memoryProductRepository) FindByID(id uint) (*Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product, ok := r.m.products[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &product, nil
+}
+
+func (r memoryProductRepository) FindByIDs(ids []uint) ([]Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var products []Product
+	for _, id := range ids {
+		if product, ok := r.m.products[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+func (r memoryProductRepository) FindForUser(viewer *User, id uint) (*Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product, ok := r.m.products[id]
+	if !ok || !canAccess(viewer, product.UserID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &product, nil
+}
+
+func (r memoryProductRepository) Update(product *Product) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.products[product.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	product.UpdatedAt = time.Now()
+	r.m.products[product.ID] = *product
+	return nil
+}
+
+func (r memoryProductRepository) Delete(product *Product) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	// Sama seperti fk_log_products_product: produk yang pernah dibeli tidak
+	// bisa dihapus, sedangkan isi keranjang ikut terhapus (ON DELETE CASCADE)
+	for _, transaction := range r.m.transactions {
+		for _, item := range transaction.Items {
+			if item.ProductID == product.ID {
+				return errForeignKey
+			}
+		}
+	}
+	for id, item := range r.m.cartItems {
+		if item.ProductID == product.ID {
+			delete(r.m.cartItems, id)
+		}
+	}
+	delete(r.m.products, product.ID)
+	return nil
+}
+
+type memoryTransactionRepository struct{ m *memoryStore }
+
+func (r memoryTransactionRepository) Create(transaction *Transaction) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var outOfStock []outOfStockItem
+	for _, item := range sortedByProduct(transaction.Items) {
+		product, ok := r.m.products[item.ProductID]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		if product.Stock < item.Quantity {
+			outOfStock = append(outOfStock, outOfStockItem{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				Stock:     product.Stock,
+			})
+		}
+	}
+	if len(outOfStock) > 0 {
+		return &OutOfStockError{Items: outOfStock}
+	}
+	r.adjustStock(transaction.Items, -1)
+
+	transaction.ID = r.m.newID()
+	transaction.CreatedAt = time.Now()
+	transaction.UpdatedAt = transaction.CreatedAt
+	for i := range transaction.Items {
+		item := &transaction.Items[i]
+		item.ID = r.m.newID()
+		item.TransactionID = transaction.ID
+		item.CreatedAt = transaction.CreatedAt
+		item.UpdatedAt = transaction.CreatedAt
+	}
+	stored := *transaction
+	stored.Items = append([]LogProduct(nil), transaction.Items...)
+	stored.Refunds = nil
+	r.m.transactions[transaction.ID] = stored
+	r.addHistory(initialHistory(transaction))
+	return nil
+}
+
+// addHistory stores entry. The caller must hold the lock.
+func (r memoryTransactionRepository) addHistory(entry *TransactionStatusHistory) {
+	entry.ID = r.m.newID()
+	r.m.history[entry.ID] = *entry
+}
+
+// withRefunds returns transaction with its refunds, which are stored
+// separately. The caller must hold the lock.
+func (r memoryTransactionRepository) withRefunds(transaction Transaction) Transaction {
+	var ids []uint
+	for id, refund := range r.m.refunds {
+		if refund.TransactionID == transaction.ID {
+			ids = append(ids, id)
+		}
+	}
+	transaction.Refunds = make([]Refund, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		transaction.Refunds = append(transaction.Refunds, r.m.refunds[id])
+	}
+	return transaction
+}
+
+// sellerIDs returns the owners of the products of transaction. The caller
+// must hold the lock.
+func (r memoryTransactionRepository) sellerIDs(transaction Transaction) []uint {
+	ids := make([]uint, len(transaction.Items))
+	for i, item := range transaction.Items {
+		ids[i] = r.m.products[item.ProductID].UserID
+	}
+	return ids
+}
+
+// isVisible reports whether viewer bought or sold transaction. The caller
+// must hold the lock.
+func (r memoryTransactionRepository) isVisible(viewer *User, transaction Transaction) bool {
+	return canAccess(viewer, append(r.sellerIDs(transaction), transaction.UserID)...)
+}
+
+func (r memoryTransactionRepository) ListForUser(viewer *User) ([]Transaction, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ids := make([]uint, 0, len(r.m.transactions))
+	for id, transaction := range r.m.transactions {
+		if r.isVisible(viewer, transaction) {
+			ids = append(ids, id)
+		}
+	}
+	transactions := make([]Transaction, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		transactions = append(transactions, r.withRefunds(r.m.transactions[id]))
+	}
+	return transactions, nil
+}
+
+func (r memoryTransactionRepository) FindForUser(viewer *User, id uint) (*Transaction, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	transaction, ok := r.m.transactions[id]
+	if !ok || !r.isVisible(viewer, transaction) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	transaction = r.withRefunds(transaction)
+	return &transaction, nil
+}
+
+func (r memoryTransactionRepository) FindByID(id uint) (*Transaction, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	transaction, ok := r.m.transactions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	transaction = r.withRefunds(transaction)
+	return &transaction, nil
+}
+
+func (r memoryTransactionRepository) FindForSeller(viewer *User, id uint) (*Transaction, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	transaction, ok := r.m.transactions[id]
+	if !ok || !canAccess(viewer, r.sellerIDs(transaction)...) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	transaction = r.withRefunds(transaction)
+	return &transaction, nil
+}
+
+func (r memoryTransactionRepository) Update(transaction *Transaction) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.transactions[transaction.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	transaction.UpdatedAt = time.Now()
+	items := stored.Items
+	stored = *transaction
+	stored.Items = items
+	stored.Refunds = nil
+	r.m.transactions[transaction.ID] = stored
+	return nil
+}
+
+func (r memoryTransactionRepository) ChangeStatus(transaction *Transaction, change statusChange) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.transactions[transaction.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if stored.Status != transaction.Status {
+		return errTransactionStatusChanged
+	}
+	stored.Status = change.To
+	stored.UpdatedAt = time.Now()
+	r.m.transactions[transaction.ID] = stored
+	r.addHistory(newHistory(transaction, change, stored.UpdatedAt))
+	if change.Restock {
+		r.adjustStock(stored.Items, 1)
+	}
+	transaction.Status = stored.Status
+	transaction.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r memoryTransactionRepository) History(transactionID uint) ([]TransactionStatusHistory, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var ids []uint
+	for id, entry := range r.m.history {
+		if entry.TransactionID == transactionID {
+			ids = append(ids, id)
+		}
+	}
+	history := make([]TransactionStatusHistory, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		history = append(history, r.m.history[id])
+	}
+	return history, nil
+}
+
+// adjustStock adds (sign 1) or removes (sign -1) the quantities of items to
+// the stock of the products. The caller must hold the lock.
+func (r memoryTransactionRepository) adjustStock(items []LogProduct, sign int) {
+	for _, item := range items {
+		product, ok := r.m.products[item.ProductID]
+		if !ok {
+			continue
+		}
+		if sign < 0 {
+			product.Stock -= item.Quantity
+		} else {
+			product.Stock += item.Quantity
+		}
+		r.m.products[item.ProductID] = product
+	}
+}
+
+type memoryCartRepository struct{ m *memoryStore }
+
+func (r memoryCartRepository) List(userID uint) ([]CartItem, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var ids []uint
+	for id, item := range r.m.cartItems {
+		if item.UserID == userID {
+			ids = append(ids, id)
+		}
+	}
+	items := make([]CartItem, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		items = append(items, r.m.cartItems[id])
+	}
+	return items, nil
+}
+
+func (r memoryCartRepository) Find(userID, productID uint) (*CartItem, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, item := range r.m.cartItems {
+		if item.UserID == userID && item.ProductID == productID {
+			return &item, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r memoryCartRepository) Create(item *CartItem) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	item.ID = r.m.newID()
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = item.CreatedAt
+	r.m.cartItems[item.ID] = *item
+	return nil
+}
+
+func (r memoryCartRepository) Update(item *CartItem) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.cartItems[item.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	item.UpdatedAt = time.Now()
+	r.m.cartItems[item.ID] = *item
+	return nil
+}
+
+func (r memoryCartRepository) Delete(item *CartItem) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.cartItems, item.ID)
+	return nil
+}
+
+func (r memoryCartRepository) Clear(userID uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, item := range r.m.cartItems {
+		if item.UserID == userID {
+			delete(r.m.cartItems, id)
+		}
+	}
+	return nil
+}
+
+type memoryPaymentRepository struct{ m *memoryStore }
+
+func (r memoryPaymentRepository) Create(payment *Payment) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, stored := range r.m.payments {
+		if stored.Provider == payment.Provider && stored.ChargeID == payment.ChargeID {
+			return errDuplicateKey
+		}
+	}
+	payment.ID = r.m.newID()
+	payment.CreatedAt = time.Now()
+	payment.UpdatedAt = payment.CreatedAt
+	r.m.payments[payment.ID] = *payment
+	return nil
+}
+
+func (r memoryPaymentRepository) FindByID(id uint) (*Payment, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	payment, ok := r.m.payments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &payment, nil
+}
+
+func (r memoryPaymentRepository) FindByChargeID(provider, chargeID string) (*Payment, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, payment := range r.m.payments {
+		if payment.Provider == provider && payment.ChargeID == chargeID {
+			return &payment, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r memoryPaymentRepository) ListForTransaction(transactionID uint) ([]Payment, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var ids []uint
+	for id, payment := range r.m.payments {
+		if payment.TransactionID == transactionID {
+			ids = append(ids, id)
+		}
+	}
+	payments := make([]Payment, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		payments = append(payments, r.m.payments[id])
+	}
+	return payments, nil
+}
+
+func (r memoryPaymentRepository) UpdateStatus(payment *Payment, status string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.payments[payment.ID]
+	if !ok {
+		return false, gorm.ErrRecordNotFound
+	}
+	if stored.Status != payment.Status {
+		return false, nil
+	}
+	stored.Status = status
+	stored.UpdatedAt = time.Now()
+	r.m.payments[payment.ID] = stored
+	payment.Status = stored.Status
+	payment.UpdatedAt = stored.UpdatedAt
+	return true, nil
+}
+
+func (r memoryPaymentRepository) MarkRefunded(payment *Payment, refundID string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.payments[payment.ID]
+	if !ok {
+		return false, gorm.ErrRecordNotFound
+	}
+	if stored.Status != payment.Status {
+		return false, nil
+	}
+	stored.Status = PaymentRefunded
+	stored.RefundID = refundID
+	stored.UpdatedAt = time.Now()
+	r.m.payments[payment.ID] = stored
+	*payment = stored
+	return true, nil
+}
+
+func (r memoryPaymentRepository) EventProcessed(provider, eventID string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, event := range r.m.events {
+		if event.Provider == provider && event.EventID == eventID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r memoryPaymentRepository) RecordEvent(event *PaymentEvent) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, stored := range r.m.events {
+		if stored.Provider == event.Provider && stored.EventID == event.EventID {
+			return errDuplicateKey
+		}
+	}
+	event.ID = r.m.newID()
+	event.CreatedAt = time.Now()
+	r.m.events[event.ID] = *event
+	return nil
+}
+
+type memoryRefundRepository struct{ m *memoryStore }
+
+func (r memoryRefundRepository) Create(refund *Refund) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	refund.ID = r.m.newID()
+	refund.CreatedAt = time.Now()
+	refund.UpdatedAt = refund.CreatedAt
+	for i := range refund.Items {
+		item := &refund.Items[i]
+		item.ID = r.m.newID()
+		item.RefundID = refund.ID
+		item.CreatedAt = refund.CreatedAt
+	}
+	stored := *refund
+	stored.Items = append([]RefundItem(nil), refund.Items...)
+	r.m.refunds[refund.ID] = stored
+	return nil
+}
+
+func (r memoryRefundRepository) FindByID(id uint) (*Refund, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	refund, ok := r.m.refunds[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &refund, nil
+}
+
+func (r memoryRefundRepository) Approve(refund *Refund, transaction *Transaction, approval refundApproval) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	storedTransaction, ok := r.m.transactions[transaction.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if storedTransaction.Status != transaction.Status {
+		return errTransactionStatusChanged
+	}
+	stored, ok := r.m.refunds[refund.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if stored.Status != RefundRequested {
+		return errRefundReviewed
+	}
+	refunded := stored.Amount
+	quantities := map[uint]uint{}
+	for _, item := range stored.Items {
+		quantities[item.LogProductID] += item.Quantity
+	}
+	for _, other := range r.m.refunds {
+		if other.TransactionID == transaction.ID && other.inLedger() {
+			refunded += other.Amount
+			for _, item := range other.Items {
+				quantities[item.LogProductID] += item.Quantity
+			}
+		}
+	}
+	if refunded > storedTransaction.TotalPrice {
+		return errRefundExceedsTotal
+	}
+	for _, line := range storedTransaction.Items {
+		if quantities[line.ID] > line.Quantity {
+			return errRefundExceedsQuantity
+		}
+	}
+
+	now := time.Now()
+	stored.approve(approval, now)
+	r.m.refunds[refund.ID] = stored
+	transactions := memoryTransactionRepository{r.m}
+	if approval.Restock {
+		transactions.adjustStock(stored.stockItems(), 1)
+	}
+	if approval.Status != nil {
+		transactions.addHistory(newHistory(transaction, *approval.Status, now))
+		storedTransaction.Status = approval.Status.To
+	}
+	storedTransaction.UpdatedAt = now
+	r.m.transactions[transaction.ID] = storedTransaction
+
+	refund.approve(approval, now)
+	transaction.Status = storedTransaction.Status
+	transaction.UpdatedAt = now
+	return nil
+}
+
+func (r memoryRefundRepository) Settle(refund *Refund, providerRefundID string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.refunds[refund.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	if stored.Status == RefundSettling {
+		stored.settle(providerRefundID, now)
+		r.m.refunds[refund.ID] = stored
+	}
+	refund.settle(providerRefundID, now)
+	return nil
+}
+
+func (r memoryRefundRepository) Reject(refund *Refund, reviewerID uint, note string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.refunds[refund.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if stored.Status != RefundRequested {
+		return errRefundReviewed
+	}
+	now := time.Now()
+	stored.reject(reviewerID, note, now)
+	r.m.refunds[refund.ID] = stored
+	refund.reject(reviewerID, note, now)
+	return nil
+}
+
+// updateUser applies fn to the stored user with id. The caller must hold the
+// lock.
+func (m *memoryStore) updateUser(id uint, fn func(*User)) error {
+	user, ok := m.users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	fn(&user)
+	user.UpdatedAt = time.Now()
+	m.users[id] = user
+	return nil
+}
+
+type memorySessionRepository struct{ m *memoryStore }
+
+func (r memorySessionRepository) Create(token *RefreshToken) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.create(token)
+}
+
+// create stores token. The caller must hold the lock.
+func (r memorySessionRepository) create(token *RefreshToken) error {
+	for _, stored := range r.m.refreshTokens {
+		if stored.TokenHash == token.TokenHash {
+			return errDuplicateKey
+		}
+	}
+	token.ID = r.m.newID()
+	token.CreatedAt = time.Now()
+	token.UpdatedAt = token.CreatedAt
+	r.m.refreshTokens[token.ID] = *token
+	return nil
+}
+
+func (r memorySessionRepository) FindByHash(tokenHash string) (*RefreshToken, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, token := range r.m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r memorySessionRepository) Rotate(token *RefreshToken, next *RefreshToken) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.refreshTokens[token.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if stored.RevokedAt != nil {
+		return errRefreshTokenReused
+	}
+	if err := r.create(next); err != nil {
+		return err
+	}
+	now := time.Now()
+	stored.RevokedAt = &now
+	r.m.refreshTokens[token.ID] = stored
+	token.RevokedAt = &now
+	return nil
+}
+
+func (r memorySessionRepository) RevokeFamily(familyID string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.revokeWhere(func(token RefreshToken) bool { return token.FamilyID == familyID })
+	return nil
+}
+
+func (r memorySessionRepository) RevokeAll(userID uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	now := time.Now().Truncate(time.Microsecond)
+	if err := r.m.updateUser(userID, func(user *User) { user.TokensValidAfter = &now }); err != nil {
+		return err
+	}
+	r.revokeWhere(func(token RefreshToken) bool { return token.UserID == userID })
+	return nil
+}
+
+// revokeWhere revokes the unrevoked tokens matching match. The caller must
+// hold the lock.
+func (r memorySessionRepository) revokeWhere(match func(RefreshToken) bool) {
+	now := time.Now()
+	for id, token := range r.m.refreshTokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &now
+			r.m.refreshTokens[id] = token
+		}
+	}
+}
+
+type memoryMFARepository struct{ m *memoryStore }
+
+func (r memoryMFARepository) SetSecret(userID uint, secret string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.updateUser(userID, func(user *User) { user.TOTPSecret = secret })
+}
+
+func (r memoryMFARepository) Enable(userID uint, codeHashes []string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.updateUser(userID, func(user *User) { user.TOTPEnabled = true }); err != nil {
+		return err
+	}
+	r.deleteCodes(userID)
+	now := time.Now()
+	for _, hash := range codeHashes {
+		code := RecoveryCode{ID: r.m.newID(), UserID: userID, CodeHash: hash, CreatedAt: now, UpdatedAt: now}
+		r.m.recoveryCodes[code.ID] = code
+	}
+	return nil
+}
+
+func (r memoryMFARepository) Disable(userID uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	err := r.m.updateUser(userID, func(user *User) {
+		user.TOTPEnabled = false
+		user.TOTPSecret = ""
+	})
+	if err != nil {
+		return err
+	}
+	r.deleteCodes(userID)
+	delete(r.m.totpSteps, userID)
+	return nil
+}
+
+// deleteCodes deletes the recovery codes of the user. The caller must hold
+// the lock.
+func (r memoryMFARepository) deleteCodes(userID uint) {
+	for id, code := range r.m.recoveryCodes {
+		if code.UserID == userID {
+			delete(r.m.recoveryCodes, id)
+		}
+	}
+}
+
+func (r memoryMFARepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, code := range r.m.recoveryCodes {
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			code.UpdatedAt = now
+			r.m.recoveryCodes[id] = code
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r memoryMFARepository) AcceptStep(userID uint, step int64) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if last, ok := r.m.totpSteps[userID]; ok && last.Step >= step {
+		return false, nil
+	}
+	r.m.totpSteps[userID] = TOTPStep{UserID: userID, Step: step, UpdatedAt: time.Now()}
+	return true, nil
+}
+
+type memoryVerificationRepository struct{ m *memoryStore }
+
+// newest returns the newest code matching match. The caller must hold the
+// lock.
+func (r memoryVerificationRepository) newest(match func(VerificationCode) bool) (*VerificationCode, error) {
+	var newest *VerificationCode
+	for _, code := range r.m.verificationCodes {
+		if match(code) && (newest == nil || code.ID > newest.ID) {
+			code := code
+			newest = &code
+		}
+	}
+	if newest == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return newest, nil
+}
+
+func (r memoryVerificationRepository) Latest(userID uint, channel string) (*VerificationCode, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.newest(func(code VerificationCode) bool {
+		return code.UserID == userID && code.Channel == channel
+	})
+}
+
+func (r memoryVerificationRepository) Replace(code *VerificationCode) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	now := time.Now()
+	for id, stored := range r.m.verificationCodes {
+		if stored.UserID == code.UserID && stored.Channel == code.Channel && stored.UsedAt == nil {
+			stored.UsedAt = &now
+			r.m.verificationCodes[id] = stored
+		}
+	}
+	code.ID = r.m.newID()
+	code.CreatedAt = now
+	code.UpdatedAt = now
+	r.m.verificationCodes[code.ID] = *code
+	return nil
+}
+
+func (r memoryVerificationRepository) FindPending(userID uint, channel, target string) (*VerificationCode, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.newest(func(code VerificationCode) bool {
+		return code.UserID == userID && code.Channel == channel && code.Target == target && code.UsedAt == nil
+	})
+}
+
+func (r memoryVerificationRepository) AddAttempt(code *VerificationCode) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.verificationCodes[code.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	stored.Attempts++
+	r.m.verificationCodes[code.ID] = stored
+	code.Attempts = stored.Attempts
+	return nil
+}
+
+func (r memoryVerificationRepository) Confirm(code *VerificationCode, at time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.verificationCodes[code.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	err := r.m.updateUser(code.UserID, func(user *User) {
+		if code.Channel == ChannelPhone {
+			user.PhoneVerifiedAt = &at
+		} else {
+			user.EmailVerifiedAt = &at
+		}
+	})
+	if err != nil {
+		return err
+	}
+	stored.UsedAt = &at
+	r.m.verificationCodes[code.ID] = stored
+	code.UsedAt = &at
+	return nil
+}
+
+type memoryPasswordResetRepository struct{ m *memoryStore }
+
+func (r memoryPasswordResetRepository) Replace(token *PasswordResetToken) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	now := time.Now()
+	for id, stored := range r.m.passwordResets {
+		if stored.UserID == token.UserID && stored.UsedAt == nil {
+			stored.UsedAt = &now
+			r.m.passwordResets[id] = stored
+		}
+	}
+	token.ID = r.m.newID()
+	token.CreatedAt = now
+	token.UpdatedAt = now
+	r.m.passwordResets[token.ID] = *token
+	return nil
+}
+
+func (r memoryPasswordResetRepository) FindByHash(tokenHash string) (*PasswordResetToken, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, token := range r.m.passwordResets {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r memoryPasswordResetRepository) Consume(token *PasswordResetToken, hashedPassword string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.passwordResets[token.ID]
+	if !ok || stored.UsedAt != nil {
+		return errInvalidResetToken
+	}
+	if err := r.m.updateUser(token.UserID, func(user *User) { user.Password = hashedPassword }); err != nil {
+		return err
+	}
+	now := time.Now()
+	stored.UsedAt = &now
+	r.m.passwordResets[token.ID] = stored
+	token.UsedAt = &now
+	return nil
+}
+
+type memoryLoginAttemptRepository struct{ m *memoryStore }
+
+func (r memoryLoginAttemptRepository) Create(attempt *LoginAttempt) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	attempt.ID = r.m.newID()
+	attempt.CreatedAt = time.Now()
+	r.m.loginAttempts[attempt.ID] = *attempt
+	return nil
+}
+
+type memoryIdempotencyKeyRepository struct{ m *memoryStore }
+
+func (r memoryIdempotencyKeyRepository) Find(userID uint, key string) (*IdempotencyKey, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, record := range r.m.idempotencyKeys {
+		if record.UserID == userID && record.Key == key {
+			return &record, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r memoryIdempotencyKeyRepository) Create(record *IdempotencyKey) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, stored := range r.m.idempotencyKeys {
+		if stored.UserID == record.UserID && stored.Key == record.Key {
+			return errDuplicateKey
+		}
+	}
+	record.ID = r.m.newID()
+	record.CreatedAt = time.Now()
+	record.UpdatedAt = record.CreatedAt
+	r.m.idempotencyKeys[record.ID] = *record
+	return nil
+}
+
+func (r memoryIdempotencyKeyRepository) Complete(record *IdempotencyKey) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.idempotencyKeys[record.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	record.UpdatedAt = time.Now()
+	record.LockedUntil = nil
+	r.m.idempotencyKeys[record.ID] = *record
+	return nil
+}
+
+func (r memoryIdempotencyKeyRepository) Reclaim(record *IdempotencyKey, now time.Time) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.idempotencyKeys[record.ID]
+	if !ok || stored.StatusCode != 0 || (stored.LockedUntil != nil && !stored.LockedUntil.Before(now)) {
+		return false, nil
+	}
+	delete(r.m.idempotencyKeys, record.ID)
+	return true, nil
+}
+
+func (r memoryIdempotencyKeyRepository) Delete(record *IdempotencyKey) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.idempotencyKeys, record.ID)
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// Server holds the dependencies shared by the HTTP handlers. Handlers are
+// methods on Server so they use the single pooled database handle instead of
+// opening their own connections.
+type Server struct {
+	config         *Config
+	db             *gorm.DB
+	tokens         *TokenService
+	mailer         Mailer
+	sms            SMSSender
+	payments       PaymentProvider
+	accountLimiter *LoginLimiter
+	ipLimiter      *LoginLimiter
+
+	// repo persists every model. Handlers only use repo, never db, so they
+	// can also run against newMemoryRepositories; db is left to the cleanup
+	// worker.
+	repo Repositories
+
+	// requireVerifiedForTransactions blocks users whose email and phone are
+	// not verified from creating transactions.
+	requireVerifiedForTransactions bool
+
+	// background counts work that handlers started after responding (e.g.
+	// password reset e-mails); run waits for it before closing the database.
+	background sync.WaitGroup
+}
+
+// NewServer creates a Server whose dependencies are built from cfg; callers
+// may replace them before calling routes.
+func NewServer(cfg *Config, db *gorm.DB, tokens *TokenService) *Server {
+	accountLimiter, ipLimiter := newLoginLimiters(cfg.Login, newMemoryAttemptStore())
+	return &Server{
+		config:         cfg,
+		db:             db,
+		repo:           newGormRepositories(db),
+		tokens:         tokens,
+		mailer:         newMailer(cfg.Notifier),
+		sms:            newSMSSender(cfg.Notifier),
+		payments:       newPaymentProvider(cfg.Payment),
+		accountLimiter: accountLimiter,
+		ipLimiter:      ipLimiter,
+
+		requireVerifiedForTransactions: cfg.Verification.RequiredForTransactions,
+	}
+}
+
+// httpServer returns the HTTP server for the API with the configured
+// timeouts. Without them a slow client could hold a connection forever.
+func (s *Server) httpServer() *http.Server {
+	cfg := s.config.Server
+	return &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           s.routes(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// routes registers every API route and returns the root handler.
+func (s *Server) routes() http.Handler {
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	api := r.PathPrefix("/api").Subrouter()
+
+	// Public routes: login and register
+	public := api.PathPrefix("/auth").Subrouter()
+	public.HandleFunc("/register", s.registerHandler).Methods("POST")
+	public.HandleFunc("/login", s.loginHandler).Methods("POST")
+	public.HandleFunc("/mfa", s.mfaLoginHandler).Methods("POST")
+	public.HandleFunc("/refresh", s.refreshTokenHandler).Methods("POST")
+	public.HandleFunc("/logout", s.logoutHandler).Methods("POST")
+	public.HandleFunc("/forgot-password", s.forgotPasswordHandler).Methods("POST")
+	public.HandleFunc("/reset-password", s.resetPasswordHandler).Methods("POST")
+
+	// Webhook dari payment provider diautentikasi lewat signature, bukan JWT
+	api.HandleFunc("/payments/webhook", s.paymentWebhookHandler).Methods("POST")
+
+	// Protected routes: semua route lain membutuhkan token JWT yang valid
+	protected := api.NewRoute().Subrouter()
+	protected.Use(s.authMiddleware)
+	// Retry POST/PUT dengan Idempotency-Key yang sama mendapat response pertama
+	protected.Use(s.idempotencyMiddleware)
+
+	// Route-level RBAC untuk operasi yang hanya boleh dilakukan role tertentu
+	manageCategories := RequirePermission(PermManageCategories)
+	manageProducts := RequirePermission(PermManageProducts)
+	confirmTransactions := RequirePermission(PermConfirmTransactions)
+
+	// Account routes
+	protected.HandleFunc("/accounts/me", s.getAccountHandler).Methods("GET")
+	protected.HandleFunc("/accounts/me", s.updateAccountHandler).Methods("PUT")
+	protected.HandleFunc("/accounts/me/logout", s.logoutAccountHandler).Methods("POST")
+	protected.HandleFunc("/accounts/me/verify", s.verifyAccountHandler).Methods("POST")
+	protected.HandleFunc("/accounts/me/verify/resend", s.resendVerificationHandler).Methods("POST")
+	protected.HandleFunc("/accounts/me/mfa/totp", s.enrollTOTPHandler).Methods("POST")
+	protected.HandleFunc("/accounts/me/mfa/totp/confirm", s.confirmTOTPHandler).Methods("POST")
+	protected.HandleFunc("/accounts/me/mfa/totp", s.disableTOTPHandler).Methods("DELETE")
+
+	// Address routes
+	protected.HandleFunc("/addresses", s.createAddressHandler).Methods("POST")
+	protected.HandleFunc("/addresses/{id}", s.getAddressHandler).Methods("GET")
+	protected.HandleFunc("/addresses/{id}", s.updateAddressHandler).Methods("PUT")
+	protected.HandleFunc("/addresses/{id}", s.deleteAddressHandler).Methods("DELETE")
+
+	// Category routes
+	protected.Handle("/categories", manageCategories(http.HandlerFunc(s.createCategoryHandler))).Methods("POST")
+	protected.HandleFunc("/categories", s.getCategoryListHandler).Methods("GET")
+	protected.HandleFunc("/categories/{id}", s.getCategoryHandler).Methods("GET")
+	protected.Handle("/categories/{id}", manageCategories(http.HandlerFunc(s.updateCategoryHandler))).Methods("PUT")
+	protected.Handle("/categories/{id}", manageCategories(http.HandlerFunc(s.deleteCategoryHandler))).Methods("DELETE")
+
+	// Product routes
+	protected.Handle("/products", manageProducts(http.HandlerFunc(s.createProductHandler))).Methods("POST")
+	protected.HandleFunc("/products", s.getProductListHandler).Methods("GET")
+	protected.HandleFunc("/products/{id}", s.getProductHandler).Methods("GET")
+	protected.Handle("/products/{id}", manageProducts(http.HandlerFunc(s.updateProductHandler))).Methods("PUT")
+	protected.Handle("/products/{id}", manageProducts(http.HandlerFunc(s.deleteProductHandler))).Methods("DELETE")
+
+	// Cart routes; item routes are addressed by product ID
+	protected.HandleFunc("/cart", s.getCartHandler).Methods("GET")
+	protected.HandleFunc("/cart", s.clearCartHandler).Methods("DELETE")
+	protected.HandleFunc("/cart/items", s.addCartItemHandler).Methods("POST")
+	protected.HandleFunc("/cart/items/{id}", s.updateCartItemHandler).Methods("PUT")
+	protected.HandleFunc("/cart/items/{id}", s.removeCartItemHandler).Methods("DELETE")
+	protected.Handle("/cart/checkout", s.requireVerified(http.HandlerFunc(s.checkoutCartHandler))).Methods("POST")
+
+	// Transaction routes
+	protected.Handle("/transactions", s.requireVerified(http.HandlerFunc(s.createTransactionHandler))).Methods("POST")
+	protected.HandleFunc("/transactions", s.getTransactionListHandler).Methods("GET")
+	protected.HandleFunc("/transactions/{id}", s.getTransactionHandler).Methods("GET")
+	protected.HandleFunc("/transactions/{id}/history", s.getTransactionHistoryHandler).Methods("GET")
+	protected.HandleFunc("/transactions/{id}/cancel", s.transitionHandler(StatusCancelled)).Methods("POST")
+	protected.Handle("/transactions/{id}/confirm", confirmTransactions(s.transitionHandler(StatusConfirmed))).Methods("POST")
+	protected.Handle("/transactions/{id}/ship", confirmTransactions(s.transitionHandler(StatusShipped))).Methods("POST")
+	protected.Handle("/transactions/{id}/deliver", confirmTransactions(s.transitionHandler(StatusDelivered))).Methods("POST")
+	protected.HandleFunc("/transactions/{id}/complete", s.transitionHandler(StatusCompleted)).Methods("POST")
+
+	// Refund routes; buyer meminta, seller atau admin menyetujui
+	protected.HandleFunc("/transactions/{id}/refunds", s.createRefundHandler).Methods("POST")
+	protected.HandleFunc("/transactions/{id}/refunds", s.getRefundListHandler).Methods("GET")
+	protected.Handle("/refunds/{id}/approve", confirmTransactions(http.HandlerFunc(s.approveRefundHandler))).Methods("POST")
+	protected.Handle("/refunds/{id}/reject", confirmTransactions(http.HandlerFunc(s.rejectRefundHandler))).Methods("POST")
+
+	// Payment routes
+	protected.HandleFunc("/transactions/{id}/payments", s.createPaymentHandler).Methods("POST")
+	protected.HandleFunc("/transactions/{id}/payments", s.getPaymentListHandler).Methods("GET")
+	// Simulasi membuat buyer bisa melunasi pesanannya sendiri, jadi hanya
+	// ada di dev dan test
+	if _, ok := s.payments.(*fakePaymentProvider); ok && s.config.Env != ProfileProd {
+		protected.HandleFunc("/payments/{id}/simulate", s.simulatePaymentHandler).Methods("POST")
+	}
+
+	// Admin routes
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(RequireRole(RoleAdmin))
+	admin.HandleFunc("/users/{id}/role", s.updateUserRoleHandler).Methods("PUT")
+	admin.HandleFunc("/users/{id}/unlock", s.unlockUserHandler).Methods("POST")
+	// Pembayaran manual (mis. transfer bank) ditandai lunas oleh admin
+	admin.HandleFunc("/transactions/{id}/paid", s.transitionHandler(StatusPaid)).Methods("POST")
+
+	// CORS dan access log membungkus router agar juga berlaku untuk preflight dan 404
+	var handler http.Handler = r
+	handler = corsMiddleware(s.config.CORS)(handler)
+	handler = accessLogMiddleware(s.config.Log)(handler)
+	return handler
+}
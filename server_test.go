@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// testBackends lists the repository implementations every handler test runs
+// against: the gorm repositories on a migrated SQLite file, and the memory
+// repositories.
+var testBackends = []string{DialectSQLite, "memory"}
+
+// testServer is the API served by httptest with its own empty database.
+type testServer struct {
+	t      *testing.T
+	srv    *Server
+	http   *httptest.Server
+	phones int
+}
+
+// forEachBackend runs fn once per repository backend, each time against a
+// fresh server.
+func forEachBackend(t *testing.T, fn func(t *testing.T, ts *testServer)) {
+	for _, backend := range testBackends {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			fn(t, newTestServer(t, backend))
+		})
+	}
+}
+
+// newTestServer starts the API on the given backend. The SQLite database is
+// a file in the temp dir of the test with every migration applied.
+func newTestServer(t *testing.T, backend string) *testServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := defaultConfig(ProfileTest)
+	cfg.Database.Database = filepath.Join(dir, "test.db")
+	cfg.Notifier = NotifierConfig{MailerFile: filepath.Join(dir, "mail.log"), SMSFile: filepath.Join(dir, "sms.log")}
+	cfg.JWT.SigningKeys = []SigningKey{{ID: "test", Secret: "test-signing-key-0123456789abcdef"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	tokens, err := newTokenServiceFromConfig(cfg.JWT)
+	if err != nil {
+		t.Fatalf("token service: %v", err)
+	}
+
+	var srv *Server
+	switch backend {
+	case DialectSQLite:
+		db, err := connectDB(cfg.Database)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		migrations, err := loadMigrations(migrationFiles, path.Join(migrationsDir, db.Dialect().GetName()))
+		if err != nil {
+			t.Fatalf("load migrations: %v", err)
+		}
+		if _, err := NewMigrator(db, migrations).Up(0); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		srv = NewServer(&cfg, db, tokens)
+	case "memory":
+		srv = NewServer(&cfg, nil, tokens)
+		srv.repo = newMemoryRepositories()
+	default:
+		t.Fatalf("unknown backend %q", backend)
+	}
+
+	ts := &testServer{t: t, srv: srv, http: httptest.NewServer(srv.routes())}
+	t.Cleanup(ts.http.Close)
+	// Pekerjaan background harus selesai sebelum database ditutup
+	t.Cleanup(srv.background.Wait)
+	return ts
+}
+
+// do sends a JSON request, decodes the response into out unless it is nil
+// and returns the status code.
+func (ts *testServer) do(method, endpoint, token string, body, out interface{}) int {
+	ts.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatalf("marshal: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.http.URL+endpoint, reader)
+	if err != nil {
+		ts.t.Fatalf("request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := ts.http.Client().Do(req)
+	if err != nil {
+		ts.t.Fatalf("%s %s: %v", method, endpoint, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			ts.t.Fatalf("%s %s: decode: %v", method, endpoint, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// expect sends a request like do and fails the test on another status.
+func (ts *testServer) expect(status int, method, endpoint, token string, body, out interface{}) {
+	ts.t.Helper()
+	if got := ts.do(method, endpoint, token, body, out); got != status {
+		ts.t.Fatalf("%s %s: status %d, want %d", method, endpoint, got, status)
+	}
+}
+
+// user registers an account with the given role and logs it in. It returns
+// the user and its access token.
+func (ts *testServer) user(name, role string) (*User, string) {
+	ts.t.Helper()
+
+	ts.phones++
+	email := strings.ToLower(name) + "@example.com"
+	ts.expect(http.StatusCreated, "POST", "/api/auth/register", "", registerRequest{
+		Name:     name,
+		Email:    email,
+		Phone:    fmt.Sprintf("08120000%04d", ts.phones),
+		Password: "password123",
+	}, nil)
+
+	user, err := ts.srv.repo.Users.FindByEmail(email)
+	if err != nil {
+		ts.t.Fatalf("find %s: %v", email, err)
+	}
+	if role != RoleBuyer {
+		if err := ts.srv.repo.Users.UpdateRole(user, role); err != nil {
+			ts.t.Fatalf("role %s: %v", role, err)
+		}
+	}
+
+	return user, ts.login(email).Token
+}
+
+// login logs in with the password every test user has and returns the
+// session.
+func (ts *testServer) login(email string) tokenPair {
+	ts.t.Helper()
+	var session tokenPair
+	ts.expect(http.StatusOK, "POST", "/api/auth/login", "", loginRequest{Email: email, Password: "password123"}, &session)
+	return session
+}
+
+// category creates a category as admin.
+func (ts *testServer) category(adminToken string) uint {
+	ts.t.Helper()
+	var category struct {
+		ID uint `json:"id"`
+	}
+	ts.expect(http.StatusCreated, "POST", "/api/categories", adminToken, categoryRequest{Name: "Books"}, &category)
+	return category.ID
+}
+
+// product creates a product of the seller with the given stock.
+func (ts *testServer) product(sellerToken string, categoryID, stock uint) productResponse {
+	ts.t.Helper()
+	var product productResponse
+	ts.expect(http.StatusCreated, "POST", "/api/products", sellerToken, productRequest{
+		CategoryID: categoryID,
+		Name:       "Go Programming",
+		Price:      1000,
+		Stock:      stock,
+	}, &product)
+	return product
+}
+
+// address creates an address of the buyer.
+func (ts *testServer) address(buyerToken string) addressResponse {
+	ts.t.Helper()
+	var address addressResponse
+	ts.expect(http.StatusCreated, "POST", "/api/addresses", buyerToken, addressRequest{
+		Name:     "Rumah",
+		Street:   "Jl. Merdeka 1",
+		City:     "Bandung",
+		Province: "Jawa Barat",
+		Zipcode:  "40111",
+	}, &address)
+	return address
+}
+
+// order creates a transaction of the buyer for quantity items of product.
+func (ts *testServer) order(buyerToken string, addressID, productID, quantity uint) (int, transactionResponse) {
+	ts.t.Helper()
+	var transaction transactionResponse
+	status := ts.do("POST", "/api/transactions", buyerToken, createTransactionRequest{
+		AddressID: addressID,
+		Items:     []transactionItemRequest{{ProductID: productID, Quantity: quantity}},
+	}, &transaction)
+	return status, transaction
+}
+
+// stock returns the stock of a product as reported by the API.
+func (ts *testServer) stock(token string, productID uint) uint {
+	ts.t.Helper()
+	var product productResponse
+	ts.expect(http.StatusOK, "GET", fmt.Sprintf("/api/products/%d", productID), token, nil, &product)
+	return product.Stock
+}
+
+func TestAuthHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, token := ts.user("Alice", RoleBuyer)
+
+		// Email yang sama tidak bisa didaftarkan dua kali
+		ts.expect(http.StatusConflict, "POST", "/api/auth/register", "", registerRequest{
+			Name:     "Alice",
+			Email:    "alice@example.com",
+			Phone:    "081299999999",
+			Password: "password123",
+		}, nil)
+		ts.expect(http.StatusUnprocessableEntity, "POST", "/api/auth/register", "", registerRequest{
+			Name:     "Bob",
+			Email:    "not-an-email",
+			Phone:    "081288888888",
+			Password: "short",
+		}, nil)
+		ts.expect(http.StatusBadRequest, "POST", "/api/auth/login", "", loginRequest{
+			Email:    "alice@example.com",
+			Password: "wrong-password",
+		}, nil)
+
+		var me struct {
+			Email string `json:"email"`
+		}
+		ts.expect(http.StatusOK, "GET", "/api/accounts/me", token, nil, &me)
+		if me.Email != "alice@example.com" {
+			t.Errorf("email = %q, want alice@example.com", me.Email)
+		}
+		ts.expect(http.StatusUnauthorized, "GET", "/api/accounts/me", "", nil, nil)
+		ts.expect(http.StatusUnauthorized, "GET", "/api/accounts/me", "invalid", nil, nil)
+	})
+}
+
+// signToken signs claims for userID with secret under kid, bypassing the
+// token service of the server.
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, secret interface{}, userID uint) string {
+	t.Helper()
+	now := time.Now()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"user_id": userID,
+		"typ":     tokenTypeAccess,
+		"iss":     defaultJWTIssuer,
+		"aud":     defaultJWTAudience,
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTVerification(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		alice, token := ts.user("Alice", RoleBuyer)
+		secret := []byte("test-signing-key-0123456789abcdef")
+
+		ts.expect(http.StatusOK, "GET", "/api/accounts/me", signToken(t, jwt.SigningMethodHS256, "test", secret, alice.ID), nil, nil)
+		for name, forged := range map[string]string{
+			"alg none":     signToken(t, jwt.SigningMethodNone, "test", jwt.UnsafeAllowNoneSignatureType, alice.ID),
+			"unknown kid":  signToken(t, jwt.SigningMethodHS256, "other", secret, alice.ID),
+			"wrong secret": signToken(t, jwt.SigningMethodHS256, "test", []byte("another-signing-key-0123456789ab"), alice.ID),
+			"HS512":        signToken(t, jwt.SigningMethodHS512, "test", secret, alice.ID),
+		} {
+			if status := ts.do("GET", "/api/accounts/me", forged, nil, nil); status != http.StatusUnauthorized {
+				t.Errorf("%s: status %d, want 401", name, status)
+			}
+		}
+
+		// Rotasi: key baru dipakai untuk token baru, token lama tetap berlaku
+		// sampai key lama dihapus
+		rotated, err := NewTokenService(map[string][]byte{
+			"test": secret,
+			"next": []byte("next-signing-key-0123456789abcdef"),
+		}, "next", defaultJWTIssuer, defaultJWTAudience, defaultAccessTTL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts.srv.tokens = rotated
+		ts.expect(http.StatusOK, "GET", "/api/accounts/me", token, nil, nil)
+		next := ts.login("alice@example.com")
+		parsed, _, err := new(jwt.Parser).ParseUnverified(next.Token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kid := parsed.Header["kid"]; kid != "next" {
+			t.Errorf("new token signed with kid %v, want next", kid)
+		}
+
+		retired, err := NewTokenService(map[string][]byte{
+			"next": []byte("next-signing-key-0123456789abcdef"),
+		}, "next", defaultJWTIssuer, defaultJWTAudience, defaultAccessTTL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts.srv.tokens = retired
+		ts.expect(http.StatusUnauthorized, "GET", "/api/accounts/me", token, nil, nil)
+		ts.expect(http.StatusOK, "GET", "/api/accounts/me", next.Token, nil, nil)
+	})
+}
+
+// totpCode returns the TOTP code of secret for step.
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotp(key, uint64(step))
+}
+
+func TestTOTPStepCannotBeReused(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, token := ts.user("Alice", RoleBuyer)
+		var enrolled totpEnrollResponse
+		ts.expect(http.StatusOK, "POST", "/api/accounts/me/mfa/totp", token, nil, &enrolled)
+
+		step := time.Now().Unix() / totpPeriod
+		var recovery struct {
+			Codes []string `json:"recovery_codes"`
+		}
+		ts.expect(http.StatusOK, "POST", "/api/accounts/me/mfa/totp/confirm", token, totpCodeRequest{Code: totpCode(t, enrolled.Secret, step)}, &recovery)
+
+		challenge := func() string {
+			var resp mfaChallengeResponse
+			ts.expect(http.StatusOK, "POST", "/api/auth/login", "", loginRequest{Email: "alice@example.com", Password: "password123"}, &resp)
+			if !resp.MFARequired {
+				t.Fatal("login did not ask for a second factor")
+			}
+			return resp.MFAToken
+		}
+
+		// Kode konfirmasi sudah terpakai, jadi tidak bisa dipakai untuk login
+		ts.expect(http.StatusUnauthorized, "POST", "/api/auth/mfa", "", mfaLoginRequest{MFAToken: challenge(), Code: totpCode(t, enrolled.Secret, step)}, nil)
+		next := totpCode(t, enrolled.Secret, step+1)
+		ts.expect(http.StatusOK, "POST", "/api/auth/mfa", "", mfaLoginRequest{MFAToken: challenge(), Code: next}, nil)
+		ts.expect(http.StatusUnauthorized, "POST", "/api/auth/mfa", "", mfaLoginRequest{MFAToken: challenge(), Code: next}, nil)
+
+		// Recovery code juga hanya berlaku sekali
+		ts.expect(http.StatusOK, "POST", "/api/auth/mfa", "", mfaLoginRequest{MFAToken: challenge(), Code: recovery.Codes[0]}, nil)
+		ts.expect(http.StatusUnauthorized, "POST", "/api/auth/mfa", "", mfaLoginRequest{MFAToken: challenge(), Code: recovery.Codes[0]}, nil)
+	})
+}
+
+func TestLoginBackoffAndLockout(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		alice, aliceToken := ts.user("Alice", RoleBuyer)
+		// Jam limiter akun dimajukan manual agar test tidak perlu menunggu
+		now := time.Now()
+		ts.srv.accountLimiter.now = func() time.Time { return now }
+
+		wrong := loginRequest{Email: "alice@example.com", Password: "wrong-password"}
+		for i := 0; i < 3; i++ {
+			ts.expect(http.StatusBadRequest, "POST", "/api/auth/login", "", wrong, nil)
+		}
+		// Setelah dua kegagalan gratis setiap percobaan harus menunggu backoff
+		ts.expect(http.StatusTooManyRequests, "POST", "/api/auth/login", "", wrong, nil)
+		now = now.Add(time.Second)
+		ts.expect(http.StatusBadRequest, "POST", "/api/auth/login", "", wrong, nil)
+		ts.expect(http.StatusTooManyRequests, "POST", "/api/auth/login", "", wrong, nil)
+		now = now.Add(2 * time.Second)
+		ts.expect(http.StatusBadRequest, "POST", "/api/auth/login", "", wrong, nil)
+
+		// Kegagalan kelima mengunci akun, password yang benar pun ditolak
+		correct := loginRequest{Email: "alice@example.com", Password: "password123"}
+		now = now.Add(time.Minute)
+		ts.expect(http.StatusTooManyRequests, "POST", "/api/auth/login", "", correct, nil)
+
+		unlock := fmt.Sprintf("/api/admin/users/%d/unlock", alice.ID)
+		ts.expect(http.StatusForbidden, "POST", unlock, aliceToken, nil, nil)
+		ts.expect(http.StatusOK, "POST", unlock, adminToken, nil, nil)
+		ts.expect(http.StatusOK, "POST", "/api/auth/login", "", correct, nil)
+	})
+}
+
+func TestUpdateAccount(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		alice, token := ts.user("Alice", RoleBuyer)
+		bob, _ := ts.user("Bob", RoleBuyer)
+
+		// Email dan no telepon tetap unik ketika profil diubah
+		ts.expect(http.StatusConflict, "PUT", "/api/accounts/me", token, updateAccountRequest{Name: "Alice", Email: bob.Email, Phone: alice.Phone}, nil)
+		ts.expect(http.StatusConflict, "PUT", "/api/accounts/me", token, updateAccountRequest{Name: "Alice", Email: alice.Email, Phone: bob.Phone}, nil)
+
+		// Salinan user yang lama hanya menulis kolom profil, role yang diubah
+		// setelahnya tidak tertimpa
+		stale, err := ts.srv.repo.Users.FindByID(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.srv.repo.Users.UpdateRole(alice, RoleSeller); err != nil {
+			t.Fatal(err)
+		}
+		stale.Name = "Alice Liddell"
+		if err := ts.srv.repo.Users.Update(stale); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ts.srv.repo.Users.FindByID(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Alice Liddell" || got.Role != RoleSeller || got.Password != alice.Password {
+			t.Errorf("user after update = name %q, role %q, password changed %v", got.Name, got.Role, got.Password != alice.Password)
+		}
+	})
+}
+
+func TestAddressHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, token := ts.user("Alice", RoleBuyer)
+		address := ts.address(token)
+		endpoint := fmt.Sprintf("/api/addresses/%d", address.ID)
+
+		update := addressRequest{Name: "Kantor", Street: "Jl. Asia Afrika 8", City: "Bandung", Province: "Jawa Barat", Zipcode: "40112"}
+		var updated addressResponse
+		ts.expect(http.StatusOK, "PUT", endpoint, token, update, &updated)
+		if updated.Name != "Kantor" || updated.Zipcode != "40112" {
+			t.Errorf("updated address = %+v", updated)
+		}
+
+		update.Zipcode = "123"
+		ts.expect(http.StatusUnprocessableEntity, "PUT", endpoint, token, update, nil)
+		ts.expect(http.StatusBadRequest, "GET", "/api/addresses/abc", token, nil, nil)
+
+		ts.expect(http.StatusOK, "DELETE", endpoint, token, nil, nil)
+		ts.expect(http.StatusNotFound, "GET", endpoint, token, nil, nil)
+	})
+}
+
+func TestProductHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		_, sellerToken := ts.user("Seller", RoleSeller)
+		_, buyerToken := ts.user("Buyer", RoleBuyer)
+		categoryID := ts.category(adminToken)
+
+		// Buyer tidak punya permission products:manage
+		ts.expect(http.StatusForbidden, "POST", "/api/products", buyerToken, productRequest{
+			CategoryID: categoryID, Name: "Go Programming", Price: 1000,
+		}, nil)
+		ts.expect(http.StatusUnprocessableEntity, "POST", "/api/products", sellerToken, productRequest{
+			Name: "Go Programming", Price: 1000,
+		}, nil)
+		ts.expect(http.StatusNotFound, "POST", "/api/products", sellerToken, productRequest{
+			CategoryID: categoryID + 100, Name: "Go Programming", Price: 1000,
+		}, nil)
+
+		product := ts.product(sellerToken, categoryID, 5)
+		var products []productResponse
+		ts.expect(http.StatusOK, "GET", "/api/products", buyerToken, nil, &products)
+		if len(products) != 1 || products[0].ID != product.ID {
+			t.Errorf("products = %+v, want only %d", products, product.ID)
+		}
+
+		// Kategori yang masih dipakai produk tidak bisa dihapus
+		ts.expect(http.StatusConflict, "DELETE", fmt.Sprintf("/api/categories/%d", categoryID), adminToken, nil, nil)
+	})
+}
+
+func TestTransactionHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		_, sellerToken := ts.user("Seller", RoleSeller)
+		_, buyerToken := ts.user("Buyer", RoleBuyer)
+		product := ts.product(sellerToken, ts.category(adminToken), 5)
+		address := ts.address(buyerToken)
+
+		status, transaction := ts.order(buyerToken, address.ID, product.ID, 2)
+		if status != http.StatusCreated {
+			t.Fatalf("create transaction: status %d", status)
+		}
+		if transaction.TotalPrice != 2000 || transaction.Status != StatusPendingPayment {
+			t.Errorf("transaction = %+v, want total 2000 and status pending_payment", transaction)
+		}
+		if got := ts.stock(buyerToken, product.ID); got != 3 {
+			t.Errorf("stock after order = %d, want 3", got)
+		}
+
+		if status, _ := ts.order(buyerToken, address.ID, product.ID, 4); status != http.StatusConflict {
+			t.Errorf("order above stock: status %d, want 409", status)
+		}
+
+		// Membatalkan transaksi mengembalikan stok
+		endpoint := fmt.Sprintf("/api/transactions/%d", transaction.ID)
+		ts.expect(http.StatusOK, "POST", endpoint+"/cancel", buyerToken, nil, nil)
+		if got := ts.stock(buyerToken, product.ID); got != 5 {
+			t.Errorf("stock after cancel = %d, want 5", got)
+		}
+		ts.expect(http.StatusConflict, "POST", endpoint+"/cancel", buyerToken, nil, nil)
+
+		// Produk yang pernah dibeli tetap dirujuk oleh item transaksi
+		ts.expect(http.StatusConflict, "DELETE", fmt.Sprintf("/api/products/%d", product.ID), sellerToken, nil, nil)
+	})
+}
+
+func TestCartHandlers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		_, sellerToken := ts.user("Seller", RoleSeller)
+		_, buyerToken := ts.user("Buyer", RoleBuyer)
+		categoryID := ts.category(adminToken)
+		book := ts.product(sellerToken, categoryID, 5)
+		other := ts.product(sellerToken, categoryID, 5)
+		address := ts.address(buyerToken)
+
+		var cart cartResponse
+		ts.expect(http.StatusOK, "POST", "/api/cart/items", buyerToken, addCartItemRequest{ProductID: book.ID, Quantity: 2}, &cart)
+		// Produk yang sama ditambahkan ke baris yang sudah ada
+		ts.expect(http.StatusOK, "POST", "/api/cart/items", buyerToken, addCartItemRequest{ProductID: book.ID, Quantity: 1}, &cart)
+		if len(cart.Items) != 1 || cart.TotalQuantity != 3 || cart.TotalPrice != 3000 || !cart.CanCheckout {
+			t.Errorf("cart after adding = %+v", cart)
+		}
+		ts.expect(http.StatusNotFound, "POST", "/api/cart/items", buyerToken, addCartItemRequest{ProductID: book.ID + 100, Quantity: 1}, nil)
+
+		// Produk yang dihapus seller ikut hilang dari keranjang
+		ts.expect(http.StatusOK, "POST", "/api/cart/items", buyerToken, addCartItemRequest{ProductID: other.ID, Quantity: 1}, nil)
+		ts.expect(http.StatusOK, "DELETE", fmt.Sprintf("/api/products/%d", other.ID), sellerToken, nil, nil)
+		ts.expect(http.StatusOK, "GET", "/api/cart", buyerToken, nil, &cart)
+		if len(cart.Items) != 1 || cart.Items[0].ProductID != book.ID {
+			t.Errorf("cart after deleting a product = %+v", cart)
+		}
+
+		item := fmt.Sprintf("/api/cart/items/%d", book.ID)
+		ts.expect(http.StatusOK, "PUT", item, buyerToken, updateCartItemRequest{Quantity: 6}, &cart)
+		if cart.CanCheckout || cart.Items[0].InStock {
+			t.Errorf("cart above stock = %+v, want no checkout", cart)
+		}
+		ts.expect(http.StatusConflict, "POST", "/api/cart/checkout", buyerToken, checkoutRequest{AddressID: address.ID}, nil)
+
+		ts.expect(http.StatusOK, "PUT", item, buyerToken, updateCartItemRequest{Quantity: 4}, nil)
+		var transaction transactionResponse
+		ts.expect(http.StatusCreated, "POST", "/api/cart/checkout", buyerToken, checkoutRequest{AddressID: address.ID}, &transaction)
+		if transaction.TotalPrice != 4000 || len(transaction.Items) != 1 || transaction.Items[0].Quantity != 4 {
+			t.Errorf("transaction from cart = %+v", transaction)
+		}
+		if got := ts.stock(buyerToken, book.ID); got != 1 {
+			t.Errorf("stock after checkout = %d, want 1", got)
+		}
+
+		ts.expect(http.StatusOK, "GET", "/api/cart", buyerToken, nil, &cart)
+		if len(cart.Items) != 0 || cart.CanCheckout {
+			t.Errorf("cart after checkout = %+v, want empty", cart)
+		}
+		ts.expect(http.StatusUnprocessableEntity, "POST", "/api/cart/checkout", buyerToken, checkoutRequest{AddressID: address.ID}, nil)
+		ts.expect(http.StatusNotFound, "PUT", item, buyerToken, updateCartItemRequest{Quantity: 1}, nil)
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// tokenPair is returned by login and refresh. "token" is kept as the name of
+// the access token so existing clients keep working.
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type logoutAccountRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	AllDevices   bool   `json:"all_devices"`
+}
+
+// randomToken returns a URL-safe random string with n bytes of entropy.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the value stored in the database for an opaque token, so
+// a leaked table cannot be replayed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSession starts a new refresh token family for the user and returns the
+// first access/refresh token pair of that family.
+func (s *Server) issueSession(userID uint) (*tokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, record, err := s.newRefreshToken(userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Sessions.Create(record); err != nil {
+		return nil, err
+	}
+	return s.newTokenPair(userID, refreshToken)
+}
+
+// newRefreshToken returns a new refresh token of the family together with
+// the record to store for it.
+func (s *Server) newRefreshToken(userID uint, familyID string) (string, *RefreshToken, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refreshToken, &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.tokens.refreshTTL),
+	}, nil
+}
+
+// newTokenPair issues an access token to go with refreshToken.
+func (s *Server) newTokenPair(userID uint, refreshToken string) (*tokenPair, error) {
+	accessToken, err := s.generateToken(int64(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.tokens.accessTTL / time.Second),
+	}, nil
+}
+
+// findRefreshToken returns the stored record of refreshToken.
+func (s *Server) findRefreshToken(refreshToken string) (*RefreshToken, error) {
+	record, err := s.repo.Sessions.FindByHash(hashToken(refreshToken))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidRefreshToken
+	}
+	return record, err
+}
+
+// rotateRefreshToken exchanges a refresh token for a new pair. Every refresh
+// token can be used once; presenting an already rotated token means it was
+// stolen, so the whole family is revoked.
+func (s *Server) rotateRefreshToken(refreshToken string) (*tokenPair, error) {
+	record, err := s.findRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.RevokedAt != nil {
+		if err := s.repo.Sessions.RevokeFamily(record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenReused
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	next, nextRecord, err := s.newRefreshToken(record.UserID, record.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Sessions.Rotate(record, nextRecord); err != nil {
+		return nil, err
+	}
+	return s.newTokenPair(record.UserID, next)
+}
+
+// revokeRefreshToken revokes the family the given refresh token belongs to.
+// When owner is set, a token of another user is treated as invalid.
+func (s *Server) revokeRefreshToken(refreshToken string, owner *User) error {
+	record, err := s.findRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	if owner != nil && record.UserID != owner.ID {
+		return errInvalidRefreshToken
+	}
+	return s.repo.Sessions.RevokeFamily(record.FamilyID)
+}
+
+// revokeAllSessions revokes every refresh token of the user and invalidates
+// access tokens issued so far.
+func (s *Server) revokeAllSessions(userID uint) error {
+	return s.repo.Sessions.RevokeAll(userID)
+}
+
+func (s *Server) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	pair, err := s.rotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errRefreshTokenReused) {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, err.Error()))
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pair)
+}
+
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if err := s.revokeRefreshToken(req.RefreshToken, nil); err != nil && !errors.Is(err, errInvalidRefreshToken) {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// logoutAccountHandler logs the authenticated user out of the current session,
+// or out of every device when "all_devices" is set.
+func (s *Server) logoutAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req logoutAccountRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	var err error
+	switch {
+	case req.AllDevices:
+		err = s.revokeAllSessions(user.ID)
+	case req.RefreshToken != "":
+		err = s.revokeRefreshToken(req.RefreshToken, user)
+	default:
+		writeError(w, r, newAPIError(http.StatusBadRequest, "refresh_token or all_devices is required"))
+		return
+	}
+	// Refresh token milik user lain dianggap tidak ditemukan
+	if errors.Is(err, errInvalidRefreshToken) {
+		writeError(w, r, newAPIError(http.StatusNotFound, "Refresh token not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
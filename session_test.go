@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLogoutRevokesOnlyOwnRefreshToken(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, aliceToken := ts.user("Alice", RoleBuyer)
+		ts.user("Bob", RoleBuyer)
+		bob := ts.login("bob@example.com")
+
+		// Alice tidak bisa mengakhiri sesi Bob walaupun memegang refresh token-nya
+		ts.expect(http.StatusNotFound, "POST", "/api/accounts/me/logout", aliceToken, logoutAccountRequest{RefreshToken: bob.RefreshToken}, nil)
+		ts.expect(http.StatusNotFound, "POST", "/api/accounts/me/logout", aliceToken, logoutAccountRequest{RefreshToken: "unknown"}, nil)
+
+		var next tokenPair
+		ts.expect(http.StatusOK, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: bob.RefreshToken}, &next)
+
+		ts.expect(http.StatusOK, "POST", "/api/accounts/me/logout", next.Token, logoutAccountRequest{RefreshToken: next.RefreshToken}, nil)
+		ts.expect(http.StatusUnauthorized, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: next.RefreshToken}, nil)
+	})
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		ts.user("Alice", RoleBuyer)
+		first := ts.login("alice@example.com")
+
+		var second tokenPair
+		ts.expect(http.StatusOK, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: first.RefreshToken}, &second)
+		if second.RefreshToken == first.RefreshToken {
+			t.Fatal("refresh returned the same refresh token")
+		}
+		ts.expect(http.StatusOK, "GET", "/api/accounts/me", second.Token, nil, nil)
+
+		var third tokenPair
+		ts.expect(http.StatusOK, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: second.RefreshToken}, &third)
+		ts.expect(http.StatusOK, "GET", "/api/accounts/me", third.Token, nil, nil)
+	})
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		ts.user("Alice", RoleBuyer)
+		stolen := ts.login("alice@example.com")
+		other := ts.login("alice@example.com")
+
+		var next tokenPair
+		ts.expect(http.StatusOK, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: stolen.RefreshToken}, &next)
+
+		// Token yang sudah dirotasi dipakai lagi: seluruh family dicabut
+		ts.expect(http.StatusUnauthorized, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: stolen.RefreshToken}, nil)
+		ts.expect(http.StatusUnauthorized, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: next.RefreshToken}, nil)
+
+		// Sesi lain milik user yang sama tidak ikut dicabut
+		ts.expect(http.StatusOK, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: other.RefreshToken}, nil)
+	})
+}
+
+func TestLogoutAllDevices(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		ts.user("Alice", RoleBuyer)
+		phone := ts.login("alice@example.com")
+		laptop := ts.login("alice@example.com")
+
+		ts.expect(http.StatusOK, "POST", "/api/accounts/me/logout", laptop.Token, logoutAccountRequest{AllDevices: true}, nil)
+
+		for _, pair := range []tokenPair{phone, laptop} {
+			ts.expect(http.StatusUnauthorized, "GET", "/api/accounts/me", pair.Token, nil, nil)
+			ts.expect(http.StatusUnauthorized, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: pair.RefreshToken}, nil)
+		}
+
+		// Login lagi pada detik yang sama dengan logout tetap berlaku
+		again := ts.login("alice@example.com")
+		ts.expect(http.StatusOK, "GET", "/api/accounts/me", again.Token, nil, nil)
+		ts.expect(http.StatusOK, "POST", "/api/auth/refresh", "", refreshTokenRequest{RefreshToken: again.RefreshToken}, nil)
+	})
+}
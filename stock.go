@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+// Stock is reserved when a transaction is created: TransactionRepository.Create
+// decrements Product.Stock for every item in the same database transaction
+// that inserts the order, and fails with an *OutOfStockError without changing
+// anything when a product does not have enough stock left. Cancelling a
+// transaction puts the stock back.
+
+// errTransactionStatusChanged is returned when the status of a transaction
+// was changed by another request since it was loaded.
+var errTransactionStatusChanged = errors.New("transaction status changed concurrently")
+
+// outOfStockItem is listed in the details of a rejected order.
+type outOfStockItem struct {
+	ProductID uint `json:"product_id"`
+	Quantity  uint `json:"quantity"`
+	Stock     uint `json:"stock"`
+}
+
+// OutOfStockError lists the items of an order exceeding the available stock.
+type OutOfStockError struct {
+	Items []outOfStockItem
+}
+
+func (e *OutOfStockError) Error() string {
+	return "insufficient stock"
+}
+
+// sortedByProduct returns a copy of items sorted by product ID, so concurrent
+// orders lock the product rows in the same order and cannot deadlock.
+func sortedByProduct(items []LogProduct) []LogProduct {
+	sorted := append([]LogProduct(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ProductID < sorted[j].ProductID })
+	return sorted
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// TestParallelCheckout orders the last items of a product from many
+// goroutines at once: exactly stock orders must succeed and the stock must
+// end at zero, never below.
+func TestParallelCheckout(t *testing.T) {
+	const (
+		stock  = 5
+		buyers = 20
+	)
+
+	forEachBackend(t, func(t *testing.T, ts *testServer) {
+		_, adminToken := ts.user("Admin", RoleAdmin)
+		_, sellerToken := ts.user("Seller", RoleSeller)
+		_, buyerToken := ts.user("Buyer", RoleBuyer)
+		product := ts.product(sellerToken, ts.category(adminToken), stock)
+		address := ts.address(buyerToken)
+
+		body, err := json.Marshal(createTransactionRequest{
+			AddressID: address.ID,
+			Items:     []transactionItemRequest{{ProductID: product.ID, Quantity: 1}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// t.Fatal tidak boleh dipanggil dari goroutine lain, jadi hasilnya
+		// dikumpulkan dulu
+		statuses := make([]int, buyers)
+		errs := make([]error, buyers)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < buyers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				req, err := http.NewRequest("POST", ts.http.URL+"/api/transactions", bytes.NewReader(body))
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+buyerToken)
+				resp, err := ts.http.Client().Do(req)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				resp.Body.Close()
+				statuses[i] = resp.StatusCode
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		created, conflicts := 0, 0
+		for i, status := range statuses {
+			if errs[i] != nil {
+				t.Fatalf("order %d: %v", i, errs[i])
+			}
+			switch status {
+			case http.StatusCreated:
+				created++
+			case http.StatusConflict:
+				conflicts++
+			default:
+				t.Errorf("order %d: status %d", i, status)
+			}
+		}
+		if created != stock || conflicts != buyers-stock {
+			t.Errorf("created %d and rejected %d orders, want %d and %d", created, conflicts, stock, buyers-stock)
+		}
+		if got := ts.stock(buyerToken, product.ID); got != 0 {
+			t.Errorf("stock = %d, want 0", got)
+		}
+	})
+}
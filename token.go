@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	errNoSigningKeys = errors.New("no JWT signing keys configured")
+	errUnknownKeyID  = errors.New("unknown signing key id")
+	errInvalidClaims = errors.New("invalid token claims")
+	errTokenExpired  = errors.New("token is expired")
+	errTokenIssuedAt = errors.New("token used before issued")
+	errTokenIssuer   = errors.New("invalid token issuer")
+	errTokenAudience = errors.New("invalid token audience")
+)
+
+const (
+	defaultAccessTTL   = 15 * time.Minute
+	defaultRefreshTTL  = 30 * 24 * time.Hour
+	defaultJWTIssuer   = "e-GoLang"
+	defaultJWTAudience = "e-GoLang-api"
+)
+
+// Values of the "typ" claim. Only access tokens are accepted by authMiddleware.
+const (
+	tokenTypeAccess       = "access"
+	tokenTypeMFAChallenge = "mfa_challenge"
+)
+
+var tokenSigningAlg = jwt.SigningMethodHS256
+
+// TokenService issues and verifies HS256 JWTs. Several keys may be active at
+// once so a new key can be rolled out while tokens signed with the previous
+// one are still accepted; every token carries the id of its key in the "kid"
+// header.
+type TokenService struct {
+	keys      map[string][]byte
+	activeKID string
+	issuer    string
+	audience  string
+	accessTTL time.Duration
+	// refreshTTL is the lifetime of the opaque refresh tokens handed out
+	// alongside access tokens, see session.go.
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewTokenService creates a token service that signs with activeKID and
+// verifies with any of keys.
+func NewTokenService(keys map[string][]byte, activeKID, issuer, audience string, accessTTL time.Duration) (*TokenService, error) {
+	if len(keys) == 0 {
+		return nil, errNoSigningKeys
+	}
+	if _, ok := keys[activeKID]; !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", activeKID)
+	}
+	return &TokenService{
+		keys:       keys,
+		activeKID:  activeKID,
+		issuer:     issuer,
+		audience:   audience,
+		accessTTL:  accessTTL,
+		refreshTTL: defaultRefreshTTL,
+		now:        time.Now,
+	}, nil
+}
+
+// newTokenServiceFromConfig builds the token service from the jwt section of
+// the configuration. Without an active key id the last signing key is used.
+func newTokenServiceFromConfig(cfg JWTConfig) (*TokenService, error) {
+	keys := map[string][]byte{}
+	activeKID := cfg.ActiveKeyID
+	for _, key := range cfg.SigningKeys {
+		keys[key.ID] = []byte(key.Secret)
+		if cfg.ActiveKeyID == "" {
+			activeKID = key.ID
+		}
+	}
+
+	service, err := NewTokenService(keys, activeKID, cfg.Issuer, cfg.Audience, cfg.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+	service.refreshTTL = cfg.RefreshTTL
+	return service, nil
+}
+
+// Issue signs claims with the active key, adding the registered claims
+// (iss, aud, iat, exp) on top of the given ones. iat carries microseconds,
+// so a token issued right after User.TokensValidAfter in the same second is
+// still accepted.
+func (s *TokenService) Issue(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := s.now()
+	claims["iss"] = s.issuer
+	claims["aud"] = s.audience
+	claims["iat"] = float64(now.UnixMicro()) / 1e6
+	claims["exp"] = now.Add(ttl).Unix()
+
+	token := jwt.NewWithClaims(tokenSigningAlg, claims)
+	token.Header["kid"] = s.activeKID
+	return token.SignedString(s.keys[s.activeKID])
+}
+
+// Parse verifies the signature and the registered claims of tokenString.
+// Only HS256 is accepted, so "none" and algorithm switching are rejected
+// before the key is looked up.
+func (s *TokenService) Parse(tokenString string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods:         []string{tokenSigningAlg.Alg()},
+		SkipClaimsValidation: true,
+	}
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != tokenSigningAlg {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, errUnknownKeyID
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errInvalidClaims
+	}
+	if err := s.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *TokenService) validateClaims(claims jwt.MapClaims) error {
+	now := s.now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return errTokenExpired
+	}
+	if !claims.VerifyIssuedAt(now, true) {
+		return errTokenIssuedAt
+	}
+	if !claims.VerifyIssuer(s.issuer, true) {
+		return errTokenIssuer
+	}
+	if !claims.VerifyAudience(s.audience, true) {
+		return errTokenAudience
+	}
+	return nil
+}
+
+// issuedAtMicro returns the iat claim in microseconds since the epoch.
+func issuedAtMicro(claims jwt.MapClaims) int64 {
+	iat, _ := claims["iat"].(float64)
+	return int64(math.Round(iat * 1e6))
+}
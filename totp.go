@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults understood by every
+// authenticator app.
+const (
+	totpDigits     = 6
+	totpPeriod     = 30
+	totpSkewSteps  = 1
+	totpSecretSize = 20
+
+	recoveryCodeCount = 10
+	mfaChallengeTTL   = 5 * time.Minute
+)
+
+var (
+	errTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	errTOTPNotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	errInvalidMFACode     = errors.New("invalid authentication code")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type totpEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpURI returns the otpauth:// URI rendered as QR code by authenticator apps.
+func totpURI(issuer, secret, account string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// hotp computes the HOTP value (RFC 4226) of key for counter.
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// matchTOTP checks code against secret allowing totpSkewSteps of clock drift
+// and returns the time step the code belongs to.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	step := now.Unix() / totpPeriod
+	for i := -totpSkewSteps; i <= totpSkewSteps; i++ {
+		expected := hotp(key, uint64(step+int64(i)))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// acceptTOTP reports whether code is a valid TOTP code for secret that was
+// not used before. A code is only accepted once: its step, and every step
+// before it, is rejected afterwards.
+func (s *Server) acceptTOTP(userID uint, secret, code string) (bool, error) {
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.repo.MFA.AcceptStep(userID, step)
+}
+
+// generateRecoveryCodes returns new recovery codes. Only their hashes are
+// stored, the plain codes are shown to the user once.
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = raw[:4] + "-" + raw[4:]
+	}
+	return codes, nil
+}
+
+// verifyMFACode accepts either a current TOTP code or an unused recovery code.
+func (s *Server) verifyMFACode(user *User, code string) error {
+	if !user.TOTPEnabled {
+		return errTOTPNotEnrolled
+	}
+	ok, err := s.acceptTOTP(user.ID, user.TOTPSecret, code)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	ok, err = s.repo.MFA.UseRecoveryCode(user.ID, hashToken(strings.ToLower(strings.TrimSpace(code))))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// generateMFAChallengeToken issues the short-lived token returned by
+// loginHandler when the password is correct but a second factor is required.
+func (s *Server) generateMFAChallengeToken(userID uint) (string, error) {
+	return s.tokens.Issue(jwt.MapClaims{"user_id": userID, "typ": tokenTypeMFAChallenge}, mfaChallengeTTL)
+}
+
+func (s *Server) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, r, newAPIError(http.StatusConflict, errTOTPAlreadyEnabled.Error()))
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Secret baru belum aktif sampai dikonfirmasi dengan kode yang valid
+	if err := s.repo.MFA.SetSecret(user.ID, secret); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, totpEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: totpURI(s.tokens.issuer, secret, user.Email),
+	})
+}
+
+func (s *Server) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, r, newAPIError(http.StatusConflict, errTOTPAlreadyEnabled.Error()))
+		return
+	}
+	if user.TOTPSecret == "" {
+		writeError(w, r, newAPIError(http.StatusBadRequest, errTOTPNotEnrolled.Error()))
+		return
+	}
+
+	var req totpCodeRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	// Kode konfirmasi juga dicatat agar tidak bisa dipakai ulang untuk login
+	valid, err := s.acceptTOTP(user.ID, user.TOTPSecret, req.Code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !valid {
+		writeError(w, r, newAPIError(http.StatusBadRequest, errInvalidMFACode.Error()))
+		return
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(code)
+	}
+	if err := s.repo.MFA.Enable(user.ID, hashes); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+func (s *Server) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req totpCodeRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if err := s.verifyMFACode(user, req.Code); err != nil {
+		if errors.Is(err, errInvalidMFACode) || errors.Is(err, errTOTPNotEnrolled) {
+			writeError(w, r, newAPIError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	if err := s.repo.MFA.Disable(user.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// mfaLoginHandler is the second step of the login: it exchanges the challenge
+// token returned by loginHandler and a valid code for an access token.
+func (s *Server) mfaLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req mfaLoginRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	claims, err := s.tokens.Parse(req.MFAToken)
+	if err != nil || claims["typ"] != tokenTypeMFAChallenge {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Invalid or expired MFA token"))
+		return
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Invalid or expired MFA token"))
+		return
+	}
+
+	user, err := s.repo.Users.FindByID(uint(userID))
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Invalid or expired MFA token"))
+		return
+	}
+	if !s.checkLoginAllowed(w, r, user.Email) {
+		return
+	}
+	if err := s.verifyMFACode(user, req.Code); err != nil {
+		if errors.Is(err, errInvalidMFACode) || errors.Is(err, errTOTPNotEnrolled) {
+			s.recordLoginFailure(r, user.Email, "invalid_mfa_code")
+			writeError(w, r, newAPIError(http.StatusUnauthorized, errInvalidMFACode.Error()))
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+	// Login baru dianggap berhasil setelah faktor kedua benar
+	s.recordLoginSuccess(user.Email)
+
+	tokenPair, err := s.issueSession(user.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenPair)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Lifecycle of a transaction:
+//
+//	pending_payment -> paid -> confirmed -> shipped -> delivered -> completed
+//
+// A transaction can be cancelled until it is paid, which puts the stock back.
+// Once paid the money has to go back to the buyer, so it can only be refunded.
+// cancelled and refunded are final.
+const (
+	StatusPendingPayment = "pending_payment"
+	StatusPaid           = "paid"
+	StatusConfirmed      = "confirmed"
+	StatusShipped        = "shipped"
+	StatusDelivered      = "delivered"
+	StatusCompleted      = "completed"
+	StatusCancelled      = "cancelled"
+	StatusRefunded       = "refunded"
+)
+
+// Roles a user can play in a transaction. A seller sells at least one of its
+// items; the system changes statuses on behalf of external services (e.g.
+// the payment provider).
+const (
+	ActorBuyer  = "buyer"
+	ActorSeller = "seller"
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
+)
+
+// transition describes who may move a transaction to a status.
+type transition struct {
+	actors []string
+	// restock puts the quantities of the items back into the product stock.
+	restock bool
+}
+
+// transactionTransitions lists the allowed transitions by current status and
+// new status.
+var transactionTransitions = map[string]map[string]transition{
+	StatusPendingPayment: {
+		StatusPaid:      {actors: []string{ActorSystem, ActorAdmin}},
+		StatusCancelled: {actors: []string{ActorBuyer, ActorSeller, ActorAdmin}, restock: true},
+	},
+	StatusPaid: {
+		StatusConfirmed: {actors: []string{ActorSeller, ActorAdmin}},
+		StatusRefunded:  {actors: []string{ActorSeller, ActorAdmin}},
+	},
+	StatusConfirmed: {
+		StatusShipped:  {actors: []string{ActorSeller, ActorAdmin}},
+		StatusRefunded: {actors: []string{ActorSeller, ActorAdmin}},
+	},
+	StatusShipped: {
+		StatusDelivered: {actors: []string{ActorSeller, ActorAdmin}},
+	},
+	StatusDelivered: {
+		StatusCompleted: {actors: []string{ActorBuyer, ActorAdmin}},
+		StatusRefunded:  {actors: []string{ActorSeller, ActorAdmin}},
+	},
+	StatusCompleted: {
+		StatusRefunded: {actors: []string{ActorSeller, ActorAdmin}},
+	},
+}
+
+// statusChange is a validated transition applied by
+// TransactionRepository.ChangeStatus and recorded in the status history.
+type statusChange struct {
+	To        string
+	ActorID   uint
+	ActorRole string
+	Note      string
+	Restock   bool
+}
+
+// newHistory returns the history entry for applying change to transaction,
+// which still has its previous status.
+func newHistory(transaction *Transaction, change statusChange, at time.Time) *TransactionStatusHistory {
+	return &TransactionStatusHistory{
+		TransactionID: transaction.ID,
+		FromStatus:    transaction.Status,
+		ToStatus:      change.To,
+		ActorID:       change.ActorID,
+		ActorRole:     change.ActorRole,
+		Note:          change.Note,
+		CreatedAt:     at,
+	}
+}
+
+// initialHistory returns the history entry for a newly created transaction.
+func initialHistory(transaction *Transaction) *TransactionStatusHistory {
+	return &TransactionStatusHistory{
+		TransactionID: transaction.ID,
+		ToStatus:      transaction.Status,
+		ActorID:       transaction.UserID,
+		ActorRole:     ActorBuyer,
+		CreatedAt:     transaction.CreatedAt,
+	}
+}
+
+type changeStatusRequest struct {
+	Note string `json:"note" validate:"max=255"`
+}
+
+// transactionActors returns the roles user plays in transaction.
+func (s *Server) transactionActors(user *User, transaction *Transaction) ([]string, error) {
+	var actors []string
+	if transaction.UserID == user.ID {
+		actors = append(actors, ActorBuyer)
+	}
+
+	ids := make([]uint, len(transaction.Items))
+	for i, item := range transaction.Items {
+		ids[i] = item.ProductID
+	}
+	products, err := s.repo.Products.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		if product.UserID == user.ID {
+			actors = append(actors, ActorSeller)
+			break
+		}
+	}
+
+	if hasRole(user, RoleAdmin) {
+		actors = append(actors, ActorAdmin)
+	}
+	return actors, nil
+}
+
+// planTransition checks that a transaction in status from may move to status
+// to when changed by someone playing actors, and returns the change to apply
+// with the role the actor acts as.
+func planTransition(from, to string, actors []string) (statusChange, error) {
+	rule, ok := transactionTransitions[from][to]
+	if !ok {
+		return statusChange{}, newAPIError(http.StatusConflict,
+			fmt.Sprintf("Cannot change transaction status from %s to %s", from, to))
+	}
+	for _, allowed := range rule.actors {
+		for _, actor := range actors {
+			if actor == allowed {
+				return statusChange{To: to, ActorRole: actor, Restock: rule.restock}, nil
+			}
+		}
+	}
+	return statusChange{}, newAPIError(http.StatusForbidden,
+		fmt.Sprintf("You are not allowed to change the transaction to %s", to))
+}
+
+// changeTransactionStatus moves transaction to status on behalf of user.
+func (s *Server) changeTransactionStatus(user *User, transaction *Transaction, status, note string) error {
+	actors, err := s.transactionActors(user, transaction)
+	if err != nil {
+		return err
+	}
+	change, err := planTransition(transaction.Status, status, actors)
+	if err != nil {
+		return err
+	}
+	change.ActorID = user.ID
+	change.Note = note
+	return s.repo.Transactions.ChangeStatus(transaction, change)
+}
+
+// transitionHandler returns a handler moving the transaction {id} to status.
+// The request body is optional and may carry a note for the history.
+func (s *Server) transitionHandler(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "Invalid transaction ID")
+		if !ok {
+			return
+		}
+
+		user, ok := userFromContext(r.Context())
+		if !ok {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+			return
+		}
+
+		var req changeStatusRequest
+		if r.ContentLength != 0 && !decodeAndValidate(w, r, &req) {
+			return
+		}
+
+		// Transaksi milik user lain dianggap tidak ditemukan
+		transaction, err := s.repo.Transactions.FindForUser(user, id)
+		if err != nil {
+			writeError(w, r, notFoundOr(err, "Transaction not found"))
+			return
+		}
+
+		if err := s.changeTransactionStatus(user, transaction, status, req.Note); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		// Charge yang belum dibayar tidak boleh bisa dibayar lagi setelah batal
+		if status == StatusCancelled {
+			s.voidPendingPayments(r.Context(), transaction.ID)
+		}
+
+		writeJSON(w, http.StatusOK, newTransactionResponse(transaction))
+	}
+}
+
+func (s *Server) getTransactionHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "Invalid transaction ID")
+	if !ok {
+		return
+	}
+
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	transaction, err := s.repo.Transactions.FindForUser(user, id)
+	if err != nil {
+		writeError(w, r, notFoundOr(err, "Transaction not found"))
+		return
+	}
+
+	history, err := s.repo.Transactions.History(transaction.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStatusHistoryListResponse(history))
+}
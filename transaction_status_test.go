@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestPlanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		actors   []string
+		// status is the error status, 0 when the transition is allowed.
+		status  int
+		role    string
+		restock bool
+	}{
+		{StatusPendingPayment, StatusPaid, []string{ActorSystem}, 0, ActorSystem, false},
+		{StatusPendingPayment, StatusPaid, []string{ActorBuyer}, http.StatusForbidden, "", false},
+		{StatusPendingPayment, StatusCancelled, []string{ActorBuyer}, 0, ActorBuyer, true},
+		{StatusPendingPayment, StatusCancelled, []string{ActorSeller}, 0, ActorSeller, true},
+		{StatusPendingPayment, StatusShipped, []string{ActorAdmin}, http.StatusConflict, "", false},
+		// Transaksi yang sudah dibayar hanya bisa direfund
+		{StatusPaid, StatusCancelled, []string{ActorBuyer}, http.StatusConflict, "", false},
+		{StatusPaid, StatusCancelled, []string{ActorAdmin}, http.StatusConflict, "", false},
+		{StatusConfirmed, StatusCancelled, []string{ActorSeller}, http.StatusConflict, "", false},
+		{StatusPaid, StatusRefunded, []string{ActorSeller}, 0, ActorSeller, false},
+		{StatusPaid, StatusRefunded, []string{ActorBuyer}, http.StatusForbidden, "", false},
+		{StatusPaid, StatusConfirmed, []string{ActorBuyer, ActorSeller}, 0, ActorSeller, false},
+		{StatusConfirmed, StatusShipped, []string{ActorSeller}, 0, ActorSeller, false},
+		{StatusShipped, StatusDelivered, []string{ActorAdmin}, 0, ActorAdmin, false},
+		{StatusShipped, StatusRefunded, []string{ActorAdmin}, http.StatusConflict, "", false},
+		{StatusDelivered, StatusCompleted, []string{ActorBuyer}, 0, ActorBuyer, false},
+		{StatusDelivered, StatusCompleted, []string{ActorSeller}, http.StatusForbidden, "", false},
+		{StatusCompleted, StatusRefunded, []string{ActorAdmin}, 0, ActorAdmin, false},
+		// cancelled dan refunded adalah status akhir
+		{StatusCancelled, StatusPendingPayment, []string{ActorAdmin}, http.StatusConflict, "", false},
+		{StatusCancelled, StatusPaid, []string{ActorSystem}, http.StatusConflict, "", false},
+		{StatusRefunded, StatusCompleted, []string{ActorAdmin}, http.StatusConflict, "", false},
+	}
+	for _, tt := range tests {
+		change, err := planTransition(tt.from, tt.to, tt.actors)
+		if tt.status != 0 {
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+				t.Errorf("%s -> %s by %v: err = %v, want status %d", tt.from, tt.to, tt.actors, err, tt.status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s -> %s by %v: %v", tt.from, tt.to, tt.actors, err)
+			continue
+		}
+		if change.To != tt.to || change.ActorRole != tt.role || change.Restock != tt.restock {
+			t.Errorf("%s -> %s by %v: change = %+v", tt.from, tt.to, tt.actors, change)
+		}
+	}
+}
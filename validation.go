@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Request payloads declare their rules in a `validate` struct tag, e.g.
+//
+//	Email string `json:"email" validate:"required,email"`
+//
+// Supported rules:
+//
+//	required   value must not be empty/zero
+//	email      valid e-mail address
+//	phone      8 to 15 digits, optionally prefixed with "+"
+//	zipcode    5 digit postal code
+//	positive   number greater than zero
+//	min=N      minimum length for strings, minimum value for numbers
+//	max=N      maximum length for strings, maximum value for numbers
+//	oneof=a b  value must be one of the space separated options
+//	dive       validate every element of a slice of structs
+//
+// min and max count the items of slices. Rules other than required are
+// skipped for empty values.
+var (
+	phonePattern   = regexp.MustCompile(`^\+?[0-9]{8,15}$`)
+	zipcodePattern = regexp.MustCompile(`^[0-9]{5}$`)
+)
+
+// FieldError describes why a single field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is returned when one or more fields are invalid.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validateStruct checks every field of the struct pointed to by v against
+// its `validate` tag and returns all failures, or nil.
+func validateStruct(v interface{}) ValidationErrors {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs ValidationErrors
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+
+		name := jsonFieldName(field)
+		value := rv.Field(i)
+		for _, rule := range strings.Split(tag, ",") {
+			if rule == "dive" {
+				errs = append(errs, validateElements(name, value)...)
+				continue
+			}
+			if msg := checkRule(rule, value); msg != "" {
+				errs = append(errs, FieldError{Field: name, Message: msg})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// validateElements validates every element of the slice value. Fields are
+// reported as name[i].field.
+func validateElements(name string, value reflect.Value) ValidationErrors {
+	var errs ValidationErrors
+	for i := 0; i < value.Len(); i++ {
+		for _, fe := range validateStruct(value.Index(i).Interface()) {
+			fe.Field = fmt.Sprintf("%s[%d].%s", name, i, fe.Field)
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// checkRule returns the error message for rule, or "" when value passes.
+func checkRule(rule string, value reflect.Value) string {
+	name, arg, _ := strings.Cut(rule, "=")
+
+	if name == "required" {
+		if isEmptyValue(value) {
+			return "is required"
+		}
+		return ""
+	}
+	if isEmptyValue(value) {
+		return ""
+	}
+
+	switch name {
+	case "email":
+		addr, err := mail.ParseAddress(value.String())
+		if err != nil || addr.Address != value.String() {
+			return "must be a valid email address"
+		}
+	case "phone":
+		if !phonePattern.MatchString(value.String()) {
+			return "must be a valid phone number"
+		}
+	case "zipcode":
+		if !zipcodePattern.MatchString(value.String()) {
+			return "must be a 5 digit zipcode"
+		}
+	case "positive":
+		if n, ok := numberValue(value); !ok || n <= 0 {
+			return "must be greater than zero"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid %s rule %q", name, rule))
+		}
+		return checkBound(name, limit, value)
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if fmt.Sprint(value.Interface()) == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", rule))
+	}
+	return ""
+}
+
+func checkBound(name string, limit float64, value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		length := float64(utf8.RuneCountInString(value.String()))
+		if name == "min" && length < limit {
+			return fmt.Sprintf("must be at least %v characters", limit)
+		}
+		if name == "max" && length > limit {
+			return fmt.Sprintf("must be at most %v characters", limit)
+		}
+		return ""
+	}
+	if value.Kind() == reflect.Slice {
+		length := float64(value.Len())
+		if name == "min" && length < limit {
+			return fmt.Sprintf("must have at least %v items", limit)
+		}
+		if name == "max" && length > limit {
+			return fmt.Sprintf("must have at most %v items", limit)
+		}
+		return ""
+	}
+
+	n, ok := numberValue(value)
+	if !ok {
+		return ""
+	}
+	if name == "min" && n < limit {
+		return fmt.Sprintf("must be at least %v", limit)
+	}
+	if name == "max" && n > limit {
+		return fmt.Sprintf("must be at most %v", limit)
+	}
+	return ""
+}
+
+func numberValue(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// decodeAndValidate decodes the JSON body into dst and validates it. On
+// failure it writes 400 for malformed JSON or 422 with every invalid field in
+// the error details, and returns false.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, "Invalid request body: "+err.Error()))
+		return false
+	}
+
+	if errs := validateStruct(dst); len(errs) > 0 {
+		writeError(w, r, errs)
+		return false
+	}
+	return true
+}
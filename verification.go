@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelPhone = "phone"
+
+	verificationCodeTTL         = 15 * time.Minute
+	verificationResendInterval  = time.Minute
+	maxVerificationCodeAttempts = 5
+)
+
+var (
+	errInvalidVerificationCode = errors.New("invalid or expired verification code")
+	errAlreadyVerified         = errors.New("already verified")
+	errVerificationTooSoon     = errors.New("please wait before requesting a new code")
+)
+
+type verifyRequest struct {
+	Channel string `json:"channel" validate:"required,oneof=email phone"`
+	Code    string `json:"code" validate:"required"`
+}
+
+type resendVerificationRequest struct {
+	Channel string `json:"channel" validate:"required,oneof=email phone"`
+}
+
+// isVerified reports whether both the email and the phone of the user are confirmed.
+func isVerified(user *User) bool {
+	return user.EmailVerifiedAt != nil && user.PhoneVerifiedAt != nil
+}
+
+func verifiedAt(user *User, channel string) *time.Time {
+	if channel == ChannelEmail {
+		return user.EmailVerifiedAt
+	}
+	return user.PhoneVerifiedAt
+}
+
+// randomDigits returns a numeric code of length n.
+func randomDigits(n int) (string, error) {
+	limit := big.NewInt(1)
+	for i := 0; i < n; i++ {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	v, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", n, v), nil
+}
+
+// sendVerificationCode replaces any pending code of the channel with a new
+// one and delivers it through the matching sender.
+func (s *Server) sendVerificationCode(user *User, channel string) error {
+	if verifiedAt(user, channel) != nil {
+		return errAlreadyVerified
+	}
+
+	last, err := s.repo.Verifications.Latest(user.ID, channel)
+	if err == nil && time.Since(last.CreatedAt) < verificationResendInterval {
+		return errVerificationTooSoon
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	code, err := randomDigits(6)
+	if err != nil {
+		return err
+	}
+
+	target := user.Email
+	if channel == ChannelPhone {
+		target = user.Phone
+	}
+
+	err = s.repo.Verifications.Replace(&VerificationCode{
+		UserID:    user.ID,
+		Channel:   channel,
+		Target:    target,
+		CodeHash:  hashToken(code),
+		ExpiresAt: time.Now().Add(verificationCodeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Your verification code is %s. It expires in %s.", code, verificationCodeTTL)
+	if channel == ChannelPhone {
+		return s.sms.SendSMS(target, text)
+	}
+	return s.mailer.Send(Message{To: target, Subject: "Verify your email", Body: text})
+}
+
+// confirmVerificationCode checks the code and marks the channel as verified.
+// The code must have been sent to the current email/phone of the user.
+func (s *Server) confirmVerificationCode(user *User, channel, code string) error {
+	if verifiedAt(user, channel) != nil {
+		return errAlreadyVerified
+	}
+
+	target := user.Email
+	if channel == ChannelPhone {
+		target = user.Phone
+	}
+
+	record, err := s.repo.Verifications.FindPending(user.ID, channel, target)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidVerificationCode
+		}
+		return err
+	}
+	if time.Now().After(record.ExpiresAt) || record.Attempts >= maxVerificationCodeAttempts {
+		return errInvalidVerificationCode
+	}
+
+	if record.CodeHash != hashToken(code) {
+		if err := s.repo.Verifications.AddAttempt(record); err != nil {
+			return err
+		}
+		return errInvalidVerificationCode
+	}
+
+	now := time.Now()
+	if err := s.repo.Verifications.Confirm(record, now); err != nil {
+		return err
+	}
+
+	if channel == ChannelEmail {
+		user.EmailVerifiedAt = &now
+	} else {
+		user.PhoneVerifiedAt = &now
+	}
+	return nil
+}
+
+// sendInitialVerificationCodes is called after registration. Failures are
+// only logged, the user can ask for a new code later.
+func (s *Server) sendInitialVerificationCodes(user *User) {
+	for _, channel := range []string{ChannelEmail, ChannelPhone} {
+		if err := s.sendVerificationCode(user, channel); err != nil {
+			log.Printf("failed to send %s verification code to user %d: %v", channel, user.ID, err)
+		}
+	}
+}
+
+// requireVerified rejects unverified users when requireVerifiedForTransactions
+// is enabled. It must be used behind authMiddleware.
+func (s *Server) requireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.requireVerifiedForTransactions {
+			user, ok := userFromContext(r.Context())
+			if !ok {
+				writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+				return
+			}
+			if !isVerified(user) {
+				writeError(w, r, newAPIError(http.StatusForbidden, "Please verify your email and phone first"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) verifyAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req verifyRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if err := s.confirmVerificationCode(user, req.Channel, req.Code); err != nil {
+		switch {
+		case errors.Is(err, errInvalidVerificationCode), errors.Is(err, errAlreadyVerified):
+			writeError(w, r, newAPIError(http.StatusBadRequest, err.Error()))
+		default:
+			writeError(w, r, err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+func (s *Server) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req resendVerificationRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if err := s.sendVerificationCode(user, req.Channel); err != nil {
+		switch {
+		case errors.Is(err, errAlreadyVerified):
+			writeError(w, r, newAPIError(http.StatusBadRequest, err.Error()))
+		case errors.Is(err, errVerificationTooSoon):
+			writeError(w, r, newAPIError(http.StatusTooManyRequests, err.Error()))
+		default:
+			writeError(w, r, err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Verification code sent"})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// worker is a background job run every interval until the server shuts down.
+type worker struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// workers returns the background jobs of the server.
+func (s *Server) workers() []worker {
+	return []worker{
+		{name: "cleanup", interval: s.config.Jobs.CleanupInterval, run: s.purgeExpiredRecords},
+	}
+}
+
+// startWorkers runs every worker in its own goroutine until ctx is cancelled.
+// Wait on the returned WaitGroup to know they have all stopped.
+func (s *Server) startWorkers(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for _, w := range s.workers() {
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			ticker := time.NewTicker(w.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					log.Printf("worker %s stopped", w.name)
+					return
+				case <-ticker.C:
+					if err := w.run(ctx); err != nil {
+						log.Printf("worker %s failed: %v", w.name, err)
+					}
+				}
+			}
+		}(w)
+	}
+	return &wg
+}
+
+// purgeExpiredRecords deletes refresh tokens, reset tokens, verification
+// codes and idempotency keys that can no longer be used, and old login
+// attempt audits.
+func (s *Server) purgeExpiredRecords(ctx context.Context) error {
+	now := time.Now()
+	// Refresh token yang sudah di-revoke tetap disimpan sampai expired untuk deteksi reuse
+	purges := []struct {
+		model interface{}
+		where string
+		arg   time.Time
+	}{
+		{&RefreshToken{}, "expires_at < ?", now},
+		{&PasswordResetToken{}, "expires_at < ?", now},
+		{&VerificationCode{}, "expires_at < ?", now},
+		{&IdempotencyKey{}, "expires_at < ?", now},
+		{&LoginAttempt{}, "created_at < ?", now.Add(-s.config.Jobs.LoginAttemptRetention)},
+	}
+	for _, p := range purges {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.db.Where(p.where, p.arg).Delete(p.model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}